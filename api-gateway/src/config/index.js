@@ -2,7 +2,11 @@
 
 module.exports = {
   port: process.env.PORT || 8080,
-  jwtSecret: process.env.JWT_SECRET || 'your-secret-key',
+  jwt: {
+    jwksUrl: process.env.JWKS_URL || `${process.env.AUTH_SERVICE_URL || 'http://auth-service:8081'}/.well-known/jwks.json`,
+    issuer: process.env.JWT_ISSUER || 'auth-service',
+    audience: process.env.JWT_AUDIENCE || 'talent-platform'
+  },
   services: {
     auth: process.env.AUTH_SERVICE_URL || 'http://auth-service:8081',
     budget: process.env.BUDGET_SERVICE_URL || 'http://budget-service:8082',
@@ -1,8 +1,14 @@
 const jwt = require('jsonwebtoken');
 const config = require('../config');
+const { ALGORITHMS, createKeyResolver } = require('../utils/jwks');
+
+const getKey = createKeyResolver(config.jwt.jwksUrl);
+
+// typ header of access tokens (RFC 9068)
+const ACCESS_TOKEN_TYPE = 'at+jwt';
 
 /**
- * Middleware to verify JWT token
+ * Middleware to verify JWT token against the auth service's published keys
  */
 const verifyToken = (req, res, next) => {
   const token = req.headers.authorization?.split(' ')[1];
@@ -11,13 +17,21 @@ const verifyToken = (req, res, next) => {
     return res.status(401).json({ message: 'No token provided' });
   }
   
-  try {
-    const decoded = jwt.verify(token, config.jwtSecret);
-    req.user = decoded;
+  const options = {
+    algorithms: ALGORITHMS,
+    issuer: config.jwt.issuer,
+    audience: config.jwt.audience,
+    complete: true
+  };
+  jwt.verify(token, getKey, options, (error, decoded) => {
+    // Only access tokens, and only ones that expire: the auth service signs
+    // other kinds of token with the same keys
+    if (error || decoded.header.typ !== ACCESS_TOKEN_TYPE || typeof decoded.payload.exp !== 'number') {
+      return res.status(401).json({ message: 'Invalid token' });
+    }
+    req.user = decoded.payload;
     next();
-  } catch (error) {
-    return res.status(401).json({ message: 'Invalid token' });
-  }
+  });
 };
 
 /**
@@ -40,4 +54,4 @@ const hasRole = (role) => {
 module.exports = {
   verifyToken,
   hasRole
-};
\ No newline at end of file
+};
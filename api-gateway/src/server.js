@@ -3,7 +3,6 @@ const cors = require('cors');
 const helmet = require('helmet');
 const morgan = require('morgan');
 const { createProxyMiddleware } = require('http-proxy-middleware');
-const jwt = require('jsonwebtoken');
 
 // Import routes
 const budgetRoutes = require('./routes/budget');
@@ -12,8 +11,8 @@ const recruitmentRoutes = require('./routes/recruitment');
 
 // Config
 require('dotenv').config();
+const { verifyToken } = require('./middlewares/auth');
 const PORT = process.env.PORT || 8080;
-const JWT_SECRET = process.env.JWT_SECRET || 'your-secret-key';
 
 // Service URLs
 const AUTH_SERVICE_URL = process.env.AUTH_SERVICE_URL || 'http://auth-service:8081';
@@ -29,23 +28,6 @@ app.use(helmet());
 app.use(morgan('combined'));
 app.use(express.json());
 
-// JWT Verification Middleware
-const verifyToken = (req, res, next) => {
-  const token = req.headers.authorization?.split(' ')[1];
-  
-  if (!token) {
-    return res.status(401).json({ message: 'No token provided' });
-  }
-  
-  try {
-    const decoded = jwt.verify(token, JWT_SECRET);
-    req.user = decoded;
-    next();
-  } catch (error) {
-    return res.status(401).json({ message: 'Invalid token' });
-  }
-};
-
 // Direct proxy to Auth Service for login/register
 app.use('/api/auth', createProxyMiddleware({
   target: AUTH_SERVICE_URL,
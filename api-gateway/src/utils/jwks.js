@@ -0,0 +1,66 @@
+const crypto = require('crypto');
+const axios = require('axios');
+
+// Algorithms the auth service signs with (jsonwebtoken has no EdDSA support)
+const ALGORITHMS = ['RS256', 'ES256'];
+const CACHE_TTL_MS = 5 * 60 * 1000;
+// Unknown kids refetch at most this often, so tokens with made-up kids
+// can't make us hammer the auth service
+const UNKNOWN_KID_COOLDOWN_MS = 30 * 1000;
+
+/**
+ * Fetches and caches the auth service's JSON Web Key Set, refetching when a
+ * token names a kid we have not seen yet (e.g. right after a key rotation),
+ * but no more than once per UNKNOWN_KID_COOLDOWN_MS.
+ */
+const createKeyResolver = (jwksUrl) => {
+  let keys = new Map();
+  let fetchedAt = 0;
+  let attemptedAt = 0;
+  let pending = null;
+
+  const refresh = async () => {
+    const { data } = await axios.get(jwksUrl, { timeout: 5000 });
+    const next = new Map();
+    for (const jwk of data.keys || []) {
+      if (!ALGORITHMS.includes(jwk.alg)) continue;
+      next.set(jwk.kid, crypto.createPublicKey({ key: jwk, format: 'jwk' }));
+    }
+    keys = next;
+    fetchedAt = Date.now();
+  };
+
+  const refreshOnce = () => {
+    if (!pending) {
+      attemptedAt = Date.now();
+      pending = refresh().finally(() => { pending = null; });
+    }
+    return pending;
+  };
+
+  // Key lookup in the callback form jsonwebtoken's verify() expects
+  return (header, callback) => {
+    const lookup = () => keys.get(header.kid);
+    const stale = Date.now() - fetchedAt > CACHE_TTL_MS;
+
+    if (lookup() && !stale) {
+      return callback(null, lookup());
+    }
+    // Fetched (or failed to) just now: make do with what we have
+    if (!pending && Date.now() - attemptedAt < UNKNOWN_KID_COOLDOWN_MS) {
+      const key = lookup();
+      return callback(key ? null : new Error(`Unknown signing key ${header.kid}`), key);
+    }
+    refreshOnce()
+      .then(() => {
+        const key = lookup();
+        callback(key ? null : new Error(`Unknown signing key ${header.kid}`), key);
+      })
+      .catch(callback);
+  };
+};
+
+module.exports = {
+  ALGORITHMS,
+  createKeyResolver
+};
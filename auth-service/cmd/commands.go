@@ -0,0 +1,151 @@
+package main
+
+import (
+	"auth-service/migrations"
+	"auth-service/service"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const usage = `usage: auth-service [command]
+
+Without a command the service starts. Commands:
+  audit-verify [checkpoint-file]   verify the audit log hash chain, and the
+                                   last signed checkpoint in the file if given
+  audit-checkpoint <file>          append a signed checkpoint of the chain head
+  migrate up                       apply every pending schema migration
+  migrate down                     revert the latest applied migration
+  migrate status                   list migrations and whether they're applied
+  migrate baseline <version>       record migrations up to version as applied
+                                   without running them, for a database an
+                                   earlier version set up with AutoMigrate
+`
+
+// runCommand runs a maintenance subcommand and returns the exit code
+func runCommand(s *service.AuthService, args []string) int {
+	switch args[0] {
+	case "audit-verify":
+		return auditVerify(s, args[1:])
+	case "audit-checkpoint":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		if err := s.WriteAuditCheckpoint(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, "audit-checkpoint:", err)
+			return 1
+		}
+		fmt.Println("checkpoint written to", args[1])
+		return 0
+	case "migrate":
+		return migrate(s, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+func auditVerify(s *service.AuthService, args []string) int {
+	report, err := s.VerifyAuditChain()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "audit-verify:", err)
+		return 1
+	}
+
+	if report.Legacy > 0 {
+		fmt.Printf("%d entries predate the hash chain and are not covered\n", report.Legacy)
+	}
+	if !report.Intact() {
+		fmt.Printf("BROKEN at entry %d: %s\n", report.BrokenID, report.Problem)
+		fmt.Printf("%d entries verified before it\n", report.Entries)
+		return 1
+	}
+	fmt.Printf("OK: %d entries verified, head %d %s\n", report.Entries, report.HeadID, report.HeadHash)
+
+	if len(args) > 0 {
+		claims, err := s.VerifyAuditCheckpoint(args[0])
+		if err != nil {
+			fmt.Printf("CHECKPOINT FAILED: %v\n", err)
+			return 1
+		}
+		fmt.Printf("checkpoint of %s matches entry %d\n", claims.IssuedAt.UTC().Format("2006-01-02 15:04:05Z"), claims.HeadID)
+	}
+	return 0
+}
+
+func migrate(s *service.AuthService, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	db, err := s.DB.DB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(db)
+		for _, m := range done {
+			fmt.Println("applied", m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up:", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		m, err := migrations.Down(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down:", err)
+			return 1
+		}
+		if m == nil {
+			fmt.Println("nothing to revert")
+			return 0
+		}
+		fmt.Println("reverted", m.Name)
+	case "status":
+		states, unknown, err := migrations.Status(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status:", err)
+			return 1
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.UTC().Format("2006-01-02 15:04:05Z")
+			}
+			fmt.Printf("%-22s  %s\n", applied, st.Name)
+		}
+		for _, v := range unknown {
+			fmt.Printf("%-22s  %04d (unknown to this build)\n", "applied", v)
+		}
+	case "baseline":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate baseline: invalid version", args[1])
+			return 2
+		}
+		done, err := migrations.Baseline(db, version)
+		for _, m := range done {
+			fmt.Println("recorded", m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate baseline:", err)
+			return 1
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
@@ -3,36 +3,339 @@ package main
 import (
 	"auth-service/config"
 	"auth-service/controller"
+	"auth-service/directory"
+	"auth-service/geoip"
+	"auth-service/grpcserver"
+	"auth-service/mailer"
 	"auth-service/middleware"
+	"auth-service/migrations"
+	"auth-service/notify"
+	"auth-service/oidc"
+	"auth-service/passhash"
+	"auth-service/passpolicy"
 	"auth-service/service"
+	"auth-service/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/credentials"
+	"log"
+	"os"
+	"strings"
+	"time"
 )
 
 func main() {
 	_ = godotenv.Load()
 	config.ConnectDB()
 
-	authService := &service.AuthService{DB: config.DB}
+	utils.AccessTokenTTL = config.GetDuration("ACCESS_TOKEN_TTL", utils.AccessTokenTTL)
+	utils.Issuer = config.GetEnv("JWT_ISSUER", utils.Issuer)
+	utils.Audience = config.GetEnv("JWT_AUDIENCE", utils.Audience)
+	if err := utils.LoadKeys(utils.KeyConfig{
+		Dir:            os.Getenv("JWT_KEYS_DIR"),
+		ActiveKID:      os.Getenv("JWT_ACTIVE_KID"),
+		PrivateKeyPEM:  os.Getenv("JWT_PRIVATE_KEY"),
+		PrivateKeyID:   os.Getenv("JWT_KEY_ID"),
+		RotationWindow: config.GetDuration("JWT_ROTATION_WINDOW", 24*time.Hour),
+		RetiredDir:     os.Getenv("JWT_RETIRED_KEYS_DIR"),
+	}); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	service.RefreshTokenTTL = config.GetDuration("REFRESH_TOKEN_TTL", service.RefreshTokenTTL)
+	service.PasswordResetTTL = config.GetDuration("PASSWORD_RESET_TTL", service.PasswordResetTTL)
+	service.PasswordResetURL = config.GetEnv("PASSWORD_RESET_URL", service.PasswordResetURL)
+	service.MagicLinksEnabled = config.GetBool("MAGIC_LINK_ENABLED", service.MagicLinksEnabled)
+	service.MagicLinkTTL = config.GetDuration("MAGIC_LINK_TTL", service.MagicLinkTTL)
+	service.MagicLinkURL = config.GetEnv("MAGIC_LINK_URL", service.MagicLinkURL)
+	service.MFAIssuer = config.GetEnv("MFA_ISSUER", service.MFAIssuer)
+	service.AllowSelfRegistration = config.GetBool("ALLOW_SELF_REGISTRATION", service.AllowSelfRegistration)
+	service.InvitationTTL = config.GetDuration("INVITATION_TTL", service.InvitationTTL)
+	service.InvitationURL = config.GetEnv("INVITATION_URL", service.InvitationURL)
+
+	argon := passhash.DefaultArgon2id
+	argon.Memory = uint32(config.GetInt("ARGON2_MEMORY_KIB", int(argon.Memory)))
+	argon.Time = uint32(config.GetInt("ARGON2_TIME", int(argon.Time)))
+	argon.Threads = uint8(config.GetInt("ARGON2_THREADS", int(argon.Threads)))
+	bcryptHasher := passhash.Bcrypt{Cost: config.GetInt("BCRYPT_COST", bcrypt.DefaultCost)}
+	switch hasher := config.GetEnv("PASSWORD_HASHER", "argon2id"); hasher {
+	case "argon2id":
+		service.Passwords = &passhash.Policy{Current: argon, Legacy: []passhash.Hasher{bcryptHasher}}
+	case "bcrypt":
+		service.Passwords = &passhash.Policy{Current: bcryptHasher, Legacy: []passhash.Hasher{argon}}
+	default:
+		log.Fatalf("Unknown PASSWORD_HASHER %q", hasher)
+	}
+
+	policy := &service.PasswordPolicy
+	policy.MinLength = config.GetInt("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = config.GetInt("PASSWORD_MAX_LENGTH", policy.MaxLength)
+	policy.NoContext = config.GetBool("PASSWORD_REJECT_CONTEXT", policy.NoContext)
+	policy.MinStrength = config.GetInt("PASSWORD_MIN_STRENGTH", policy.MinStrength)
+	if path := os.Getenv("PASSWORD_BREACH_FILE"); path != "" {
+		breached, err := passpolicy.OpenBreachList(path)
+		if err != nil {
+			log.Fatal("Failed to open breached password file: ", err)
+		}
+		policy.Breached = breached
+		policy.MinBreachCount = config.GetInt("PASSWORD_BREACH_MIN_COUNT", 1)
+	}
+
+	authService := &service.AuthService{
+		DB:     config.DB,
+		Mailer: mailer.New(config.GetEnv("MAILER", "log"), config.GetEnv("MAILER_FILE", "mail.log")),
+	}
+	authService.Notifier = notify.New(config.GetEnv("NOTIFIER", "mail"), authService.Mailer)
+
+	risk := &service.Risk
+	risk.Enabled = config.GetBool("LOGIN_RISK_ENABLED", risk.Enabled)
+	risk.FailureBurst = config.GetInt("LOGIN_RISK_FAILURE_BURST", risk.FailureBurst)
+	risk.IPFailureBurst = config.GetInt("LOGIN_RISK_IP_FAILURE_BURST", risk.IPFailureBurst)
+	risk.MaxTravelSpeed = float64(config.GetInt("LOGIN_RISK_MAX_TRAVEL_KMH", int(risk.MaxTravelSpeed)))
+	risk.StepUpScore = config.GetInt("LOGIN_RISK_STEP_UP_SCORE", risk.StepUpScore)
+	risk.NotifyScore = config.GetInt("LOGIN_RISK_NOTIFY_SCORE", risk.NotifyScore)
+	risk.History = config.GetDuration("LOGIN_RISK_HISTORY", risk.History)
+	if path := os.Getenv("GEOIP_FILE"); path != "" {
+		db, err := geoip.Open(path)
+		if err != nil {
+			log.Fatal("Failed to open GeoIP file: ", err)
+		}
+		service.GeoIP = db
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		authService.OIDC = &oidc.Client{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  config.GetEnv("OIDC_REDIRECT_URL", "http://localhost:8081/sso/callback"),
+			Scopes:       strings.Fields(config.GetEnv("OIDC_SCOPES", "openid email profile")),
+		}
+		service.SSOGroupsClaim = config.GetEnv("OIDC_GROUPS_CLAIM", service.SSOGroupsClaim)
+		service.SSOAutoProvision = config.GetBool("OIDC_AUTO_PROVISION", service.SSOAutoProvision)
+		service.SSOSuccessURL = os.Getenv("SSO_SUCCESS_URL")
+		groupRoles, err := service.ParseGroupRoles(os.Getenv("OIDC_GROUP_ROLES"))
+		if err != nil {
+			log.Fatal("Invalid OIDC_GROUP_ROLES: ", err)
+		}
+		service.SSOGroupRoles = groupRoles
+	}
+	for _, name := range strings.Split(config.GetEnv("AUTH_BACKENDS", "local"), ",") {
+		switch strings.TrimSpace(name) {
+		case "local":
+			authService.Authenticators = append(authService.Authenticators, service.LocalAuthenticator{DB: config.DB})
+		case "ldap":
+			if os.Getenv("LDAP_URL") == "" || os.Getenv("LDAP_BASE_DN") == "" {
+				log.Fatal("The ldap backend needs LDAP_URL and LDAP_BASE_DN")
+			}
+			groupRoles, err := service.ParseGroupRoles(os.Getenv("LDAP_GROUP_ROLES"))
+			if err != nil {
+				log.Fatal("Invalid LDAP_GROUP_ROLES: ", err)
+			}
+			authService.Authenticators = append(authService.Authenticators, service.LDAPAuthenticator{
+				DB: config.DB,
+				Directory: directory.New(directory.Config{
+					URL:                os.Getenv("LDAP_URL"),
+					StartTLS:           config.GetBool("LDAP_START_TLS", false),
+					InsecureSkipVerify: config.GetBool("LDAP_INSECURE_SKIP_VERIFY", false),
+					BindDN:             os.Getenv("LDAP_BIND_DN"),
+					BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+					BaseDN:             os.Getenv("LDAP_BASE_DN"),
+					UserFilter:         os.Getenv("LDAP_USER_FILTER"),
+					IDAttr:             os.Getenv("LDAP_ID_ATTR"),
+					EmailAttr:          os.Getenv("LDAP_EMAIL_ATTR"),
+					FirstNameAttr:      os.Getenv("LDAP_FIRST_NAME_ATTR"),
+					LastNameAttr:       os.Getenv("LDAP_LAST_NAME_ATTR"),
+					GroupAttr:          os.Getenv("LDAP_GROUP_ATTR"),
+					GroupBaseDN:        os.Getenv("LDAP_GROUP_BASE_DN"),
+					GroupFilter:        os.Getenv("LDAP_GROUP_FILTER"),
+					Timeout:            config.GetDuration("LDAP_TIMEOUT", 10*time.Second),
+				}),
+				GroupRoles:    groupRoles,
+				AutoProvision: config.GetBool("LDAP_AUTO_PROVISION", true),
+			})
+		default:
+			log.Fatalf("Unknown authentication backend %q in AUTH_BACKENDS", name)
+		}
+	}
 	authController := &controller.AuthController{Service: authService}
 
+	// Maintenance commands run against the same database and keys, then exit
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(authService, os.Args[1:]))
+	}
+
+	// Never serve from a schema older than the code expects
+	sqlDB, err := config.DB.DB()
+	if err != nil {
+		log.Fatal("Failed to get database handle: ", err)
+	}
+	if err := migrations.Check(sqlDB); err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+
+	// Tokens of disabled or deleted users stop validating right away
+	service.UserStatusCacheTTL = config.GetDuration("USER_STATUS_CACHE_TTL", service.UserStatusCacheTTL)
+	utils.AddTokenCheck(authService.CheckTokenUser)
+	// ...and so do access tokens of revoked sessions
+	service.SessionDenylistTTL = config.GetDuration("SESSION_DENYLIST_TTL", service.SessionDenylistTTL)
+	utils.AddTokenCheck(authService.CheckTokenSession)
+	// ...and of members removed from the organization they act in
+	utils.AddTokenCheck(authService.CheckTokenOrg)
+
+	service.APIKeyTTL = config.GetDuration("API_KEY_TTL", service.APIKeyTTL)
+	utils.SetAPIKeyResolver(authService.ResolveAPIKey)
+
+	if err := authService.SeedRBAC(); err != nil {
+		log.Fatal("Failed to seed roles and permissions: ", err)
+	}
+
+	if email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL"); email != "" {
+		if err := authService.EnsureAdmin(email, os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")); err != nil {
+			log.Fatal("Failed to create bootstrap admin: ", err)
+		}
+	}
+
+	service.Lockout.MaxAccountFailures = config.GetInt("LOGIN_MAX_ACCOUNT_FAILURES", service.Lockout.MaxAccountFailures)
+	service.Lockout.EmailBackoffAfter = config.GetInt("LOGIN_EMAIL_BACKOFF_AFTER", service.Lockout.EmailBackoffAfter)
+	service.Lockout.IPBackoffAfter = config.GetInt("LOGIN_IP_BACKOFF_AFTER", service.Lockout.IPBackoffAfter)
+	service.Lockout.MaxDelay = config.GetDuration("LOGIN_MAX_BACKOFF", service.Lockout.MaxDelay)
+
+	service.ImpersonationTTL = config.GetDuration("IMPERSONATION_TTL", service.ImpersonationTTL)
+	service.ImpersonatorRole = config.GetEnv("IMPERSONATOR_ROLE", service.ImpersonatorRole)
+
+	service.MaxGrantDuration = config.GetDuration("ROLE_GRANT_MAX_DURATION", service.MaxGrantDuration)
+	service.GrantApproverRole = config.GetEnv("ROLE_GRANT_APPROVER_ROLE", service.GrantApproverRole)
+	authService.StartGrantSweeper(config.GetDuration("ROLE_GRANT_SWEEP_INTERVAL", time.Minute))
+
+	if path := os.Getenv("AUDIT_CHECKPOINT_FILE"); path != "" {
+		authService.StartAuditCheckpoints(path, config.GetDuration("AUDIT_CHECKPOINT_INTERVAL", time.Hour))
+	}
+
 	r := gin.Default()
+	// Only trust X-Forwarded-For from known proxies, or anyone could pick their own IP
+	var trustedProxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies = strings.Split(v, ",")
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	// Everything done with an impersonation token ends up in the audit log
+	r.Use(middleware.MarkImpersonation(authController.AuditImpersonatedRequest))
+	// ...and some things can't be done with one at all
+	noImpersonation := middleware.DenyImpersonation()
 
 	// Public routes
+	r.GET("/.well-known/jwks.json", controller.JWKS)
 	r.POST("/register", authController.Register)
 	r.POST("/login", authController.Login)
+	r.POST("/refresh", authController.Refresh)
+	r.POST("/logout", authController.Logout)
+	r.POST("/password/forgot", authController.ForgotPassword)
+	r.POST("/password/reset", authController.ResetPassword)
+	r.POST("/login/mfa", authController.LoginMFA)
+	r.POST("/login/magic", authController.RequestMagicLink)
+	r.POST("/login/magic/verify", authController.LoginMagicLink)
+	r.GET("/sso/login", authController.SSOLogin)
+	r.GET("/sso/callback", authController.SSOCallback)
+	r.POST("/oauth/token", authController.OAuthToken)
+	r.POST("/oauth/introspect", authController.OAuthIntrospect)
+	r.POST("/oauth/revoke", authController.OAuthRevoke)
+
+	// Authenticated routes
+	account := r.Group("/")
+	account.Use(middleware.JWTAuthMiddleware())
+	{
+		account.POST("/password/change", noImpersonation, authController.ChangePassword)
+		account.POST("/mfa/enroll", noImpersonation, authController.EnrollMFA)
+		account.POST("/mfa/verify", noImpersonation, authController.VerifyMFA)
+		account.POST("/mfa/disable", noImpersonation, authController.DisableMFA)
+		account.POST("/mfa/recovery-codes", noImpersonation, authController.RegenerateRecoveryCodes)
+		account.GET("/sessions", authController.ListMySessions)
+		account.DELETE("/sessions/:sessionId", noImpersonation, authController.RevokeMySession)
+		account.POST("/role-requests", noImpersonation, authController.RequestRoleGrant)
+		account.GET("/role-requests", authController.ListMyRoleGrants)
+		account.GET("/security-events", authController.ListMySecurityEvents)
+		account.GET("/orgs", authController.ListMyOrgs)
+		account.POST("/orgs/switch", noImpersonation, authController.SwitchOrg)
+	}
 
 	// Protected routes
 	admin := r.Group("/admin")
-	admin.Use(middleware.RequireRoles("Admin"))
+	admin.Use(middleware.JWTAuthMiddleware())
 	{
-		admin.GET("/dashboard", func(c *gin.Context) {
+		admin.GET("/dashboard", middleware.RequirePermission("admin:access"), func(c *gin.Context) {
 			c.JSON(200, gin.H{"message": "Welcome Admin Dashboard"})
 		})
+		admin.GET("/users", middleware.RequirePermission("users:read"), authController.ListUsers)
+		admin.GET("/users/:id", middleware.RequirePermission("users:read"), authController.GetUser)
+		admin.PUT("/users/:id/roles", noImpersonation, middleware.RequireAllPermissions("users:write", "roles:write"), authController.SetUserRoles)
+		admin.POST("/users/:id/disable", noImpersonation, middleware.RequirePermission("users:write"), authController.DisableUser)
+		admin.POST("/users/:id/enable", noImpersonation, middleware.RequirePermission("users:write"), authController.EnableUser)
+		admin.POST("/users/:id/unlock", noImpersonation, middleware.RequirePermission("users:write"), authController.UnlockUser)
+		admin.DELETE("/users/:id", noImpersonation, middleware.RequirePermission("users:write"), authController.DeleteUser)
+		admin.GET("/users/:id/sessions", middleware.RequirePermission("users:read"), authController.ListUserSessions)
+		admin.DELETE("/users/:id/sessions", noImpersonation, middleware.RequirePermission("users:write"), authController.RevokeUserSessions)
+		admin.DELETE("/users/:id/sessions/:sessionId", noImpersonation, middleware.RequirePermission("users:write"), authController.RevokeUserSession)
+		admin.POST("/users/:id/role-grants", noImpersonation, middleware.RequireAllPermissions("users:write", "roles:write"), authController.GrantRole)
+		admin.POST("/impersonate/:userId", noImpersonation, middleware.RequirePermission("admin:access"), authController.Impersonate)
+		admin.GET("/role-grants", middleware.RequirePermission("users:read"), authController.ListRoleGrants)
+		admin.POST("/role-grants/:id/approve", noImpersonation, middleware.RequireAllPermissions("users:write", "roles:write"), authController.ApproveRoleGrant)
+		admin.POST("/role-grants/:id/deny", noImpersonation, middleware.RequireAllPermissions("users:write", "roles:write"), authController.DenyRoleGrant)
+		admin.DELETE("/role-grants/:id", noImpersonation, middleware.RequireAllPermissions("users:write", "roles:write"), authController.RevokeRoleGrant)
+		admin.POST("/orgs", noImpersonation, middleware.RequirePermission("orgs:write"), authController.CreateOrg)
+		admin.GET("/orgs", middleware.RequirePermission("orgs:write"), authController.ListOrgs)
+		admin.DELETE("/orgs/:id", noImpersonation, middleware.RequirePermission("orgs:write"), authController.DeleteOrg)
+		admin.GET("/orgs/:id/members", middleware.RequirePermission("orgs:write"), authController.ListOrgMembers)
+		admin.PUT("/orgs/:id/members/:userId", noImpersonation, middleware.RequireAllPermissions("orgs:write", "roles:write"), authController.SetOrgMember)
+		admin.DELETE("/orgs/:id/members/:userId", noImpersonation, middleware.RequirePermission("orgs:write"), authController.RemoveOrgMember)
+		admin.POST("/invitations", noImpersonation, middleware.RequirePermission("invitations:write"), authController.CreateInvitation)
+		admin.GET("/invitations", middleware.RequirePermission("invitations:write"), authController.ListInvitations)
+		admin.DELETE("/invitations/:id", noImpersonation, middleware.RequirePermission("invitations:write"), authController.RevokeInvitation)
+		admin.GET("/roles", middleware.RequirePermission("roles:write"), authController.ListRoles)
+		admin.POST("/roles", noImpersonation, middleware.RequirePermission("roles:write"), authController.CreateRole)
+		admin.PUT("/roles/:name", noImpersonation, middleware.RequirePermission("roles:write"), authController.UpdateRole)
+		admin.DELETE("/roles/:name", noImpersonation, middleware.RequirePermission("roles:write"), authController.DeleteRole)
+		admin.GET("/permissions", middleware.RequirePermission("roles:write"), authController.ListPermissions)
+		admin.POST("/permissions", noImpersonation, middleware.RequirePermission("roles:write"), authController.CreatePermission)
+		admin.DELETE("/permissions/:name", noImpersonation, middleware.RequirePermission("roles:write"), authController.DeletePermission)
+		admin.POST("/service-accounts", noImpersonation, middleware.RequirePermission("service_accounts:write"), authController.CreateServiceAccount)
+		admin.GET("/service-accounts", middleware.RequirePermission("service_accounts:write"), authController.ListServiceAccounts)
+		admin.DELETE("/service-accounts/:id", noImpersonation, middleware.RequirePermission("service_accounts:write"), authController.DeleteServiceAccount)
+		admin.POST("/service-accounts/:id/keys", noImpersonation, middleware.RequirePermission("service_accounts:write"), authController.CreateAPIKey)
+		admin.GET("/service-accounts/:id/keys", middleware.RequirePermission("service_accounts:write"), authController.ListAPIKeys)
+		admin.DELETE("/service-accounts/:id/keys/:keyId", noImpersonation, middleware.RequirePermission("service_accounts:write"), authController.RevokeAPIKey)
+		admin.POST("/oauth-clients", noImpersonation, middleware.RequirePermission("oauth_clients:write"), authController.CreateOAuthClient)
+		admin.GET("/oauth-clients", middleware.RequirePermission("oauth_clients:write"), authController.ListOAuthClients)
+		admin.DELETE("/oauth-clients/:id", noImpersonation, middleware.RequirePermission("oauth_clients:write"), authController.DeleteOAuthClient)
+		admin.GET("/audit", middleware.RequirePermission("audit:read"), authController.ListAuditLogs)
+		admin.GET("/audit/export", middleware.RequirePermission("audit:read"), authController.ExportAuditLogs)
+		admin.GET("/audit/verify", middleware.RequirePermission("audit:read"), authController.VerifyAuditChain)
+		admin.GET("/security-events", middleware.RequirePermission("audit:read"), authController.ListSecurityEvents)
+	}
+
+	// HRIS and identity providers provision with a service account key
+	scim := r.Group("/scim/v2")
+	scim.Use(middleware.JWTAuthMiddleware(), noImpersonation, middleware.RequirePermission("scim:write"))
+	{
+		scim.GET("/ServiceProviderConfig", authController.SCIMServiceProviderConfig)
+		scim.GET("/ResourceTypes", authController.SCIMResourceTypes)
+		scim.GET("/Users", authController.SCIMListUsers)
+		scim.POST("/Users", authController.SCIMCreateUser)
+		scim.GET("/Users/:id", authController.SCIMGetUser)
+		scim.PUT("/Users/:id", authController.SCIMReplaceUser)
+		scim.PATCH("/Users/:id", authController.SCIMPatchUser)
+		scim.DELETE("/Users/:id", authController.SCIMDeleteUser)
+		scim.GET("/Groups", authController.SCIMListGroups)
+		scim.POST("/Groups", authController.SCIMCreateGroup)
+		scim.GET("/Groups/:id", authController.SCIMGetGroup)
+		scim.PUT("/Groups/:id", authController.SCIMReplaceGroup)
+		scim.PATCH("/Groups/:id", authController.SCIMPatchGroup)
+		scim.DELETE("/Groups/:id", authController.SCIMDeleteGroup)
 	}
 
 	hr := r.Group("/hr")
-	hr.Use(middleware.RequireRoles("HR"))
+	hr.Use(middleware.RequirePermission("hr:access"))
 	{
 		hr.GET("/panel", func(c *gin.Context) {
 			c.JSON(200, gin.H{"message": "Welcome HR Panel"})
@@ -40,12 +343,29 @@ func main() {
 	}
 
 	manager := r.Group("/manager")
-	manager.Use(middleware.RequireRoles("Manager", "Admin"))
+	manager.Use(middleware.RequirePermission("reports:read"))
 	{
 		manager.GET("/reports", func(c *gin.Context) {
 			c.JSON(200, gin.H{"message": "Manager Reports Access"})
 		})
 	}
 
+	// The gRPC API has no client authentication of its own: it stays on the
+	// loopback interface unless clients must present a certificate
+	grpcAddr := config.GetEnv("GRPC_ADDR", "127.0.0.1:"+config.GetEnv("GRPC_PORT", "9081"))
+	var grpcCreds credentials.TransportCredentials
+	if cert := os.Getenv("GRPC_TLS_CERT"); cert != "" {
+		grpcCreds, err = grpcserver.MutualTLS(cert, os.Getenv("GRPC_TLS_KEY"), os.Getenv("GRPC_CLIENT_CA"))
+		if err != nil {
+			log.Fatal("Failed to load gRPC TLS credentials: ", err)
+		}
+	}
+	go func() {
+		log.Println("gRPC server listening on", grpcAddr)
+		if err := grpcserver.ListenAndServe(grpcAddr, authService, grpcCreds); err != nil {
+			log.Fatal("gRPC server failed: ", err)
+		}
+	}()
+
 	r.Run(":8081")
 }
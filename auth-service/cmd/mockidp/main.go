@@ -0,0 +1,258 @@
+// Command mockidp is a throwaway OpenID Connect provider for trying out and
+// testing single sign-on locally. It signs whoever fills in its login form
+// in, with whatever groups they claim. Never expose it.
+//
+//	MOCK_IDP_ADDR=:9090 MOCK_IDP_ISSUER=http://localhost:9090 go run ./cmd/mockidp
+//
+// and start the auth service with OIDC_ISSUER=http://localhost:9090 and
+// OIDC_CLIENT_ID=auth-service. Any client ID and secret are accepted.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock-idp"
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	verified    bool
+	givenName   string
+	familyName  string
+	groups      []string
+	expiresAt   time.Time
+}
+
+type provider struct {
+	issuer string
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]*grant
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Mock IdP</title>
+<h1>Mock IdP sign-in</h1>
+<form method="post">
+{{range $k, $v := .}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<p><label>Email <input name="email" value="jane@example.com" required></label></p>
+<p><label>First name <input name="given_name" value="Jane"></label></p>
+<p><label>Last name <input name="family_name" value="Doe"></label></p>
+<p><label>Groups (comma separated) <input name="groups" value="employees"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+<button>Sign in</button>
+</form>
+`))
+
+func main() {
+	addr := getEnv("MOCK_IDP_ADDR", ":9090")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &provider{
+		issuer: strings.TrimSuffix(getEnv("MOCK_IDP_ISSUER", "http://localhost"+addr), "/"),
+		key:    key,
+		grants: map[string]*grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+
+	log.Println("mock IdP", p.issuer, "listening on", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   b64(pub.N.Bytes()),
+			"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize shows the login form, and on submit redirects back with a code
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := url.Values{}
+	for _, k := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method", "response_type", "scope"} {
+		q.Set(k, r.Form.Get(k))
+	}
+	if q.Get("response_type") != "code" || q.Get("redirect_uri") == "" {
+		http.Error(w, "response_type=code and redirect_uri are required", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = loginPage.Execute(w, q)
+		return
+	}
+
+	code := randomString()
+	var groups []string
+	for _, g := range strings.Split(r.PostForm.Get("groups"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	g := &grant{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		email:       strings.TrimSpace(r.PostForm.Get("email")),
+		verified:    r.PostForm.Get("email_verified") == "true",
+		givenName:   r.PostForm.Get("given_name"),
+		familyName:  r.PostForm.Get("family_name"),
+		groups:      groups,
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mu.Lock()
+	p.grants[code] = g
+	p.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {q.Get("state")}}
+	sep := "?"
+	if strings.Contains(g.redirectURI, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, g.redirectURI+sep+back.Encode(), http.StatusFound)
+}
+
+// token redeems a code for an ID token after checking the PKCE verifier
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	if g == nil || time.Now().After(g.expiresAt) || g.clientID != clientID || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            "mock|" + strings.ToLower(g.email),
+		"aud":            g.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": g.verified,
+		"given_name":     g.givenName,
+		"family_name":    g.familyName,
+		"groups":         g.groups,
+	})
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		tokenError(w, "server_error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -6,12 +6,12 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-
-	"auth-service/model"
 )
 
 var DB *gorm.DB
 
+// ConnectDB opens DATABASE_URL. It leaves the schema alone; that's what
+// the migrate command is for.
 func ConnectDB() {
 	dsn := os.Getenv("DATABASE_URL")
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
@@ -19,13 +19,6 @@ func ConnectDB() {
 		log.Fatal("Failed to connect to DB:", err)
 	}
 
-	// 2. Add the AutoMigrate call here
-	log.Println("Running Migrations")
-	err = db.AutoMigrate(&model.User{}, &model.AuditLog{}) // Pass your model structs here
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
-	}
-
 	DB = db
 	log.Println("Database connection successful.")
 }
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnv returns the value of key, or def when it is unset or empty
+func GetEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// GetDuration parses key as a time.Duration (e.g. "15m"), falling back to def
+func GetDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid duration for %s=%q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// GetInt parses key as an integer, falling back to def
+func GetInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid integer for %s=%q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// GetBool parses key as a boolean, falling back to def
+func GetBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid boolean for %s=%q, using %t", key, v, def)
+		return def
+	}
+	return b
+}
@@ -2,8 +2,10 @@ package controller
 
 import (
 	"auth-service/service"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 )
 
 type AuthController struct {
@@ -13,9 +15,11 @@ type AuthController struct {
 // POST /register
 func (ac *AuthController) Register(c *gin.Context) {
 	var req struct {
-		Email    string   `json:"email"`
-		Password string   `json:"password"`
-		Roles    []string `json:"roles"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		FirstName       string `json:"first_name"`
+		LastName        string `json:"last_name"`
+		InvitationToken string `json:"invitation_token"`
 	}
 
 	// Bind incoming JSON
@@ -25,8 +29,21 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 
 	// Call Service Register
-	err := ac.Service.Register(req.Email, req.Password, req.Roles)
+	_, err := ac.Service.Register(service.RegisterInput{
+		Email:           req.Email,
+		Password:        req.Password,
+		FirstName:       req.FirstName,
+		LastName:        req.LastName,
+		InvitationToken: req.InvitationToken,
+	}, clientInfo(c))
 	if err != nil {
+		if errors.Is(err, service.ErrRegistrationClosed) || errors.Is(err, service.ErrInvalidInvitation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if passwordRejected(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Registration failed: " + err.Error(),
 		})
@@ -41,6 +58,7 @@ func (ac *AuthController) Login(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		OrgID    uint   `json:"org_id"` // optional, the organization to sign in to
 	}
 
 	// Bind incoming JSON
@@ -50,11 +68,90 @@ func (ac *AuthController) Login(c *gin.Context) {
 	}
 
 	// Call Service Login
-	token, err := ac.Service.Login(req.Email, req.Password)
+	result, err := ac.Service.Login(req.Email, req.Password, req.OrgID, clientInfo(c))
 	if err != nil {
+		if wait, ok := service.IsTooManyAttempts(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return
+		}
+		if errors.Is(err, service.ErrNotMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"mfa_method":   result.MFAMethod,
+			"expires_in":   int64(service.MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(result.Tokens))
+}
+
+// POST /refresh
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := ac.Service.Refresh(req.RefreshToken, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token refresh failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(pair))
+}
+
+// POST /logout
+func (ac *AuthController) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.Service.Logout(req.RefreshToken, clientInfo(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		DeviceID:  c.GetHeader("X-Device-Id"),
+	}
+}
+
+func tokenResponse(pair *service.TokenPair) gin.H {
+	return gin.H{
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    pair.ExpiresIn,
+	}
 }
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"auth-service/service"
+	"auth-service/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// POST /admin/impersonate/:userId
+func (ac *AuthController) Impersonate(c *gin.Context) {
+	userID, ok := idParam(c, "userId")
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+		OrgID  uint   `json:"org_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := ac.Service.Impersonate(currentActor(c), userID, req.OrgID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, service.ErrInvalidImpersonation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNotImpersonator), errors.Is(err, service.ErrImpersonating),
+			errors.Is(err, service.ErrNotMember):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Impersonation failed"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token.AccessToken,
+		"token_type": "Bearer",
+		"expires_in": token.ExpiresIn,
+		"session_id": token.SessionID,
+		"user":       toUserResponse(token.User),
+	})
+}
+
+// AuditImpersonatedRequest is the middleware.MarkImpersonation hook
+func (ac *AuthController) AuditImpersonatedRequest(c *gin.Context, claims *utils.Claims) {
+	ac.Service.AuditImpersonatedRequest(currentActor(c), c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type invitationResponse struct {
+	ID        uint       `json:"id"`
+	Email     string     `json:"email"`
+	Roles     []string   `json:"roles"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Token     string     `json:"token,omitempty"`
+}
+
+func toInvitationResponse(inv *model.Invitation) invitationResponse {
+	return invitationResponse{
+		ID:        inv.ID,
+		Email:     inv.Email,
+		Roles:     inv.RoleList(),
+		ExpiresAt: inv.ExpiresAt,
+		UsedAt:    inv.UsedAt,
+		RevokedAt: inv.RevokedAt,
+		CreatedAt: inv.CreatedAt,
+	}
+}
+
+// POST /admin/invitations
+func (ac *AuthController) CreateInvitation(c *gin.Context) {
+	var req struct {
+		Email     string   `json:"email" binding:"required,email"`
+		Roles     []string `json:"roles"`
+		ExpiresIn string   `json:"expires_in"` // e.g. "48h", defaults to the configured TTL
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a positive duration like 48h"})
+			return
+		}
+		ttl = d
+	}
+
+	inv, token, err := ac.Service.CreateInvitation(currentActor(c), req.Email, req.Roles, ttl)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrRoleNotGrantable) || errors.Is(err, service.ErrOrgScoped) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	resp := toInvitationResponse(inv)
+	resp.Token = token
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GET /admin/invitations
+func (ac *AuthController) ListInvitations(c *gin.Context) {
+	invs, err := ac.Service.ListInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invitations"})
+		return
+	}
+
+	out := make([]invitationResponse, len(invs))
+	for i := range invs {
+		out[i] = toInvitationResponse(&invs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": out})
+}
+
+// DELETE /admin/invitations/:id
+func (ac *AuthController) RevokeInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invitation id"})
+		return
+	}
+
+	if err := ac.Service.RevokeInvitation(currentActor(c), uint(id)); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		case errors.Is(err, service.ErrInvalidInvitation):
+			c.JSON(http.StatusConflict, gin.H{"error": "invitation was already used or revoked"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"auth-service/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GET /.well-known/jwks.json
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// magicLinkCookie binds a mailed login link to the browser that asked for it
+const magicLinkCookie = "magic_link_nonce"
+
+// POST /login/magic
+func (ac *AuthController) RequestMagicLink(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, err := ac.Service.RequestMagicLink(req.Email, clientInfo(c))
+	if err != nil {
+		if wait, ok := service.IsTooManyAttempts(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+			return
+		}
+		if errors.Is(err, service.ErrMagicLinksDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Magic link request failed"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkCookie, nonce, int(service.MagicLinkTTL.Seconds()), "/login/magic", "", c.Request.TLS != nil, true)
+	// Same answer whether or not the account exists
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a sign-in link has been sent"})
+}
+
+// POST /login/magic/verify
+func (ac *AuthController) LoginMagicLink(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+		OrgID uint   `json:"org_id"` // optional, the organization to sign in to
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, _ := c.Cookie(magicLinkCookie)
+	result, err := ac.Service.LoginWithMagicLink(req.Token, nonce, req.OrgID, clientInfo(c))
+	if err != nil {
+		if wait, ok := service.IsTooManyAttempts(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrMagicLinksDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidMagicLink):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNotMember):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Sign-in failed"})
+		}
+		return
+	}
+
+	// The link is spent, and so is the nonce
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkCookie, "", -1, "/login/magic", "", c.Request.TLS != nil, true)
+
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"mfa_method":   result.MFAMethod,
+			"expires_in":   int64(service.MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(result.Tokens))
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// POST /mfa/enroll
+func (ac *AuthController) EnrollMFA(c *gin.Context) {
+	enrollment, err := ac.Service.EnrollMFA(currentClaims(c).UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "MFA enrollment failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+	})
+}
+
+// POST /mfa/verify
+func (ac *AuthController) VerifyMFA(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := ac.Service.ActivateMFA(currentClaims(c).UserID, req.Code, clientInfo(c))
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "MFA enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// POST /mfa/disable
+func (ac *AuthController) DisableMFA(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.Service.DisableMFA(currentClaims(c).UserID, req.Code, clientInfo(c)); err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
+
+// POST /mfa/recovery-codes
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := ac.Service.RegenerateRecoveryCodes(currentClaims(c).UserID, req.Code, clientInfo(c))
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// POST /login/mfa
+func (ac *AuthController) LoginMFA(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := ac.Service.CompleteMFALogin(req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		if wait, ok := service.IsTooManyAttempts(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidMFAChallenge) || errors.Is(err, service.ErrInvalidMFACode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA code or expired challenge"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "MFA login failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(pair))
+}
+
+func mfaError(c *gin.Context, err error) {
+	if wait, ok := service.IsTooManyAttempts(err); ok {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA code"})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+	case errors.Is(err, service.ErrMFANotEnrolled), errors.Is(err, service.ErrMFANotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "MFA operation failed"})
+	}
+}
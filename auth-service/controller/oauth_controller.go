@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"auth-service/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type oauthClientResponse struct {
+	ID           uint      `json:"id"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func toOAuthClientResponse(cl *model.OAuthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ID:        cl.ID,
+		ClientID:  cl.ClientID,
+		Name:      cl.Name,
+		Scopes:    cl.ScopeList(),
+		CreatedAt: cl.CreatedAt,
+	}
+}
+
+// POST /oauth/token
+func (ac *AuthController) OAuthToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := ac.oauthClient(c)
+	if !ok {
+		return
+	}
+
+	if grant := c.PostForm("grant_type"); grant != "client_credentials" {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+		return
+	}
+
+	token, scopes, err := ac.Service.IssueClientToken(client, strings.Fields(c.PostForm("scope")), clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(utils.AccessTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// POST /oauth/introspect
+func (ac *AuthController) OAuthIntrospect(c *gin.Context) {
+	client, ok := ac.oauthClient(c)
+	if !ok {
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	info, err := ac.Service.IntrospectToken(client, token)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if !info.Active {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	resp := gin.H{
+		"active":     true,
+		"token_type": info.TokenType,
+		"exp":        info.ExpiresAt.Unix(),
+	}
+	if info.UserID != 0 {
+		resp["username"] = info.Email
+		resp["user_id"] = info.UserID
+	}
+	if cl := info.Claims; cl != nil {
+		resp["sub"] = cl.Subject
+		resp["iss"] = cl.Issuer
+		resp["roles"] = cl.ActiveRoles(time.Now())
+		resp["permissions"] = cl.Permissions
+		resp["scope"] = strings.Join(cl.Permissions, " ")
+		if cl.ClientID != "" {
+			resp["client_id"] = cl.ClientID
+		}
+		if cl.ServiceAccount != "" {
+			resp["service_account"] = cl.ServiceAccount
+		}
+		if cl.OrgID != 0 {
+			resp["org_id"] = cl.OrgID
+		}
+		if cl.Act != nil {
+			resp["act"] = cl.Act
+		}
+		if cl.ID != "" {
+			resp["jti"] = cl.ID
+		}
+		if cl.IssuedAt != nil {
+			resp["iat"] = cl.IssuedAt.Unix()
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// POST /oauth/revoke
+func (ac *AuthController) OAuthRevoke(c *gin.Context) {
+	client, ok := ac.oauthClient(c)
+	if !ok {
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := ac.Service.RevokeToken(client, token, clientInfo(c)); err != nil {
+		oauthError(c, http.StatusServiceUnavailable, "server_error", "")
+		return
+	}
+	// Unknown tokens are not an error (RFC 7009 section 2.2)
+	c.Status(http.StatusOK)
+}
+
+// POST /admin/oauth-clients
+func (ac *AuthController) CreateOAuthClient(c *gin.Context) {
+	var req struct {
+		Name   string   `json:"name" binding:"required"`
+		Scopes []string `json:"scopes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, secret, err := ac.Service.CreateOAuthClient(currentActor(c), req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownPermission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope"})
+			return
+		}
+		if errors.Is(err, service.ErrScopeNotHeld) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
+		return
+	}
+
+	resp := toOAuthClientResponse(client)
+	resp.ClientSecret = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GET /admin/oauth-clients
+func (ac *AuthController) ListOAuthClients(c *gin.Context) {
+	clients, err := ac.Service.ListOAuthClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list clients"})
+		return
+	}
+
+	out := make([]oauthClientResponse, len(clients))
+	for i := range clients {
+		out[i] = toOAuthClientResponse(&clients[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": out})
+}
+
+// DELETE /admin/oauth-clients/:id
+func (ac *AuthController) DeleteOAuthClient(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.DeleteOAuthClient(currentActor(c), id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete client"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted"})
+}
+
+// oauthClient authenticates the calling client with HTTP Basic or, failing
+// that, client_id and client_secret form fields, answering 401 itself
+func (ac *AuthController) oauthClient(c *gin.Context) (*model.OAuthClient, bool) {
+	id, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1: both parts are form-urlencoded first
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client, err := ac.Service.AuthenticateClient(id, secret)
+	if err != nil {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		if errors.Is(err, service.ErrInvalidClient) {
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "")
+		} else {
+			oauthError(c, http.StatusInternalServerError, "server_error", "")
+		}
+		return nil, false
+	}
+	return client, true
+}
+
+// oauthError answers in the error format of RFC 6749 section 5.2
+func oauthError(c *gin.Context, status int, code, description string) {
+	body := gin.H{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	c.JSON(status, body)
+}
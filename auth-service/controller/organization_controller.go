@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+type orgResponse struct {
+	ID        uint      `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toOrgResponse(o *model.Organization) orgResponse {
+	return orgResponse{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt}
+}
+
+type orgMemberResponse struct {
+	Org   orgResponse  `json:"org"`
+	User  userResponse `json:"user"`
+	Roles []string     `json:"roles"`
+}
+
+func toOrgMemberResponses(members []service.OrgMember) []orgMemberResponse {
+	out := make([]orgMemberResponse, len(members))
+	for i := range members {
+		m := &members[i]
+		out[i] = orgMemberResponse{Org: toOrgResponse(&m.Org), User: toUserResponse(&m.User), Roles: m.Roles}
+	}
+	return out
+}
+
+// GET /orgs
+func (ac *AuthController) ListMyOrgs(c *gin.Context) {
+	claims := currentClaims(c)
+	members, err := ac.Service.UserOrganizations(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		return
+	}
+
+	orgs := make([]gin.H, len(members))
+	for i := range members {
+		orgs[i] = gin.H{
+			"org":    toOrgResponse(&members[i].Org),
+			"roles":  members[i].Roles,
+			"active": members[i].Org.ID == claims.OrgID,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"orgs": orgs})
+}
+
+// POST /orgs/switch
+func (ac *AuthController) SwitchOrg(c *gin.Context) {
+	var req struct {
+		OrgID uint `json:"org_id"` // 0 leaves every organization
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := ac.Service.SwitchOrg(currentClaims(c), req.OrgID, clientInfo(c))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokenResponse(pair))
+}
+
+// POST /admin/orgs
+func (ac *AuthController) CreateOrg(c *gin.Context) {
+	var req struct {
+		Slug string `json:"slug" binding:"required"`
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, err := ac.Service.CreateOrganization(currentActor(c), req.Slug, req.Name)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toOrgResponse(org))
+}
+
+// GET /admin/orgs
+func (ac *AuthController) ListOrgs(c *gin.Context) {
+	orgs, err := ac.Service.ListOrganizations(currentActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		return
+	}
+	out := make([]orgResponse, len(orgs))
+	for i := range orgs {
+		out[i] = toOrgResponse(&orgs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"orgs": out})
+}
+
+// DELETE /admin/orgs/:id
+func (ac *AuthController) DeleteOrg(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.DeleteOrganization(currentActor(c), id); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+}
+
+// GET /admin/orgs/:id/members
+func (ac *AuthController) ListOrgMembers(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	members, err := ac.Service.ListOrgMembers(currentActor(c), id)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": toOrgMemberResponses(members)})
+}
+
+// PUT /admin/orgs/:id/members/:userId
+func (ac *AuthController) SetOrgMember(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := idParam(c, "userId")
+	if !ok {
+		return
+	}
+	var req struct {
+		Roles []string `json:"roles" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Nobody can hand out more than they hold themselves
+	perms, err := ac.Service.ResolvePermissions(req.Roles)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	claims := currentClaims(c)
+	for _, p := range perms {
+		if !claims.HasPermission(p) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot grant a role with a permission you don't have: " + p})
+			return
+		}
+	}
+
+	member, err := ac.Service.SetOrgMember(currentActor(c), id, userID, req.Roles)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toOrgMemberResponses([]service.OrgMember{*member})[0])
+}
+
+// DELETE /admin/orgs/:id/members/:userId
+func (ac *AuthController) RemoveOrgMember(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := idParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.RemoveOrgMember(currentActor(c), id, userID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+func orgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrUnknownOrg):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrImpersonating),
+		errors.Is(err, service.ErrRoleNotGrantable), errors.Is(err, service.ErrOrgScoped):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidSlug), errors.Is(err, service.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOrgExists), errors.Is(err, service.ErrSelfAdminEdit):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Organization update failed"})
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"auth-service/service"
+	"auth-service/utils"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// POST /password/change
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := currentClaims(c)
+	err := ac.Service.ChangePassword(claims.UserID, req.CurrentPassword, req.NewPassword, clientInfo(c))
+	if err != nil {
+		if wait, ok := service.IsTooManyAttempts(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		if passwordRejected(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password change failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, please sign in again"})
+}
+
+// POST /password/forgot
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.Service.RequestPasswordReset(req.Email, clientInfo(c)); err != nil {
+		if wait, ok := service.IsTooManyAttempts(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset failed"})
+		return
+	}
+
+	// Same answer whether or not the account exists
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+// POST /password/reset
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ac.Service.ResetPassword(req.Token, req.NewPassword, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		if passwordRejected(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// passwordRejected answers 400 with the failed rules if err is a password
+// policy violation
+func passwordRejected(c *gin.Context, err error) bool {
+	violations, ok := service.IsPasswordRejected(err)
+	if ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": violations,
+		})
+	}
+	return ok
+}
+
+// currentClaims returns the claims the auth middleware stored on the context
+func currentClaims(c *gin.Context) *utils.Claims {
+	return c.MustGet("user").(*utils.Claims)
+}
+
+// currentActor describes the authenticated caller for the audit log
+func currentActor(c *gin.Context) service.Actor {
+	claims := currentClaims(c)
+	actor := service.Actor{
+		UserID:      claims.UserID,
+		Email:       claims.Email,
+		Client:      clientInfo(c),
+		Permissions: claims.Permissions,
+		OrgID:       claims.OrgID,
+	}
+	if claims.ServiceAccount != "" {
+		actor.Email = "service-account:" + claims.ServiceAccount
+	}
+	if act := claims.Act; act != nil {
+		actor.Impersonator = &service.Actor{UserID: act.UserID, Email: act.Email, Client: actor.Client}
+	}
+	return actor
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type permissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type roleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func toRoleResponse(r *model.Role) roleResponse {
+	perms := make([]string, len(r.Permissions))
+	for i, p := range r.Permissions {
+		perms[i] = p.Name
+	}
+	return roleResponse{Name: r.Name, Description: r.Description, Permissions: perms}
+}
+
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// GET /admin/roles
+func (ac *AuthController) ListRoles(c *gin.Context) {
+	roles, err := ac.Service.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	out := make([]roleResponse, len(roles))
+	for i := range roles {
+		out[i] = toRoleResponse(&roles[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": out})
+}
+
+// POST /admin/roles
+func (ac *AuthController) CreateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	role, err := ac.Service.CreateRole(currentActor(c), req.Name, req.Description, req.Permissions)
+	if err != nil {
+		rbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toRoleResponse(role))
+}
+
+// PUT /admin/roles/:name
+func (ac *AuthController) UpdateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := ac.Service.UpdateRole(currentActor(c), c.Param("name"), req.Description, req.Permissions)
+	if err != nil {
+		rbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toRoleResponse(role))
+}
+
+// DELETE /admin/roles/:name
+func (ac *AuthController) DeleteRole(c *gin.Context) {
+	if err := ac.Service.DeleteRole(currentActor(c), c.Param("name")); err != nil {
+		rbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// GET /admin/permissions
+func (ac *AuthController) ListPermissions(c *gin.Context) {
+	perms, err := ac.Service.ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+
+	out := make([]permissionResponse, len(perms))
+	for i, p := range perms {
+		out[i] = permissionResponse{Name: p.Name, Description: p.Description}
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": out})
+}
+
+// POST /admin/permissions
+func (ac *AuthController) CreatePermission(c *gin.Context) {
+	var req permissionResponse
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	perm, err := ac.Service.CreatePermission(currentActor(c), req.Name, req.Description)
+	if err != nil {
+		rbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, permissionResponse{Name: perm.Name, Description: perm.Description})
+}
+
+// DELETE /admin/permissions/:name
+func (ac *AuthController) DeletePermission(c *gin.Context) {
+	if err := ac.Service.DeletePermission(currentActor(c), c.Param("name")); err != nil {
+		rbacError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Permission deleted"})
+}
+
+func rbacError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownRole):
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+	case errors.Is(err, service.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission"})
+	case errors.Is(err, service.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleNotGrantable):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Role update failed"})
+	}
+}
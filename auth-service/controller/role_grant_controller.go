@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type roleGrantResponse struct {
+	ID            uint       `json:"id"`
+	UserID        uint       `json:"user_id"`
+	Role          string     `json:"role"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	Duration      string     `json:"duration"`
+	RequestedByID uint       `json:"requested_by_id"`
+	DecidedByID   *uint      `json:"decided_by_id,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func toRoleGrantResponse(g *model.RoleGrant) roleGrantResponse {
+	return roleGrantResponse{
+		ID:            g.ID,
+		UserID:        g.UserID,
+		Role:          g.Role,
+		Reason:        g.Reason,
+		Status:        g.Status,
+		Duration:      (time.Duration(g.Duration) * time.Second).String(),
+		RequestedByID: g.RequestedByID,
+		DecidedByID:   g.DecidedByID,
+		DecidedAt:     g.DecidedAt,
+		ExpiresAt:     g.ExpiresAt,
+		RevokedAt:     g.RevokedAt,
+		CreatedAt:     g.CreatedAt,
+	}
+}
+
+func toRoleGrantResponses(grants []model.RoleGrant) []roleGrantResponse {
+	out := make([]roleGrantResponse, len(grants))
+	for i := range grants {
+		out[i] = toRoleGrantResponse(&grants[i])
+	}
+	return out
+}
+
+// bindGrantRequest reads {"role", "reason", "duration"}, answering 400 itself
+func bindGrantRequest(c *gin.Context) (service.GrantRequest, bool) {
+	var req struct {
+		Role     string `json:"role" binding:"required"`
+		Reason   string `json:"reason" binding:"required"`
+		Duration string `json:"duration" binding:"required"` // e.g. "2h"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return service.GrantRequest{}, false
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil || d <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration like 2h"})
+		return service.GrantRequest{}, false
+	}
+	return service.GrantRequest{Role: req.Role, Reason: req.Reason, Duration: d}, true
+}
+
+// POST /role-requests
+func (ac *AuthController) RequestRoleGrant(c *gin.Context) {
+	req, ok := bindGrantRequest(c)
+	if !ok {
+		return
+	}
+
+	grant, err := ac.Service.RequestRoleGrant(currentActor(c), req)
+	if err != nil {
+		roleGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toRoleGrantResponse(grant))
+}
+
+// GET /role-requests
+func (ac *AuthController) ListMyRoleGrants(c *gin.Context) {
+	actor := currentActor(c)
+	grants, err := ac.Service.ListRoleGrants(actor, actor.UserID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list role requests"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"grants": toRoleGrantResponses(grants)})
+}
+
+// GET /admin/role-grants
+func (ac *AuthController) ListRoleGrants(c *gin.Context) {
+	var userID uint
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID = uint(id)
+	}
+
+	grants, err := ac.Service.ListRoleGrants(currentActor(c), userID, c.Query("status"))
+	if errors.Is(err, service.ErrOrgScoped) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list role grants"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"grants": toRoleGrantResponses(grants)})
+}
+
+// POST /admin/users/:id/role-grants
+func (ac *AuthController) GrantRole(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	req, ok := bindGrantRequest(c)
+	if !ok {
+		return
+	}
+
+	// Nobody can hand out more than they hold themselves
+	perms, err := ac.Service.ResolvePermissions([]string{req.Role})
+	if err != nil {
+		roleGrantError(c, err)
+		return
+	}
+	claims := currentClaims(c)
+	for _, p := range perms {
+		if !claims.HasPermission(p) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot grant a role with a permission you don't have: " + p})
+			return
+		}
+	}
+
+	grant, err := ac.Service.GrantRole(currentActor(c), id, req)
+	if err != nil {
+		roleGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toRoleGrantResponse(grant))
+}
+
+// POST /admin/role-grants/:id/approve
+func (ac *AuthController) ApproveRoleGrant(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	grant, err := ac.Service.ApproveRoleGrant(currentActor(c), id)
+	if err != nil {
+		roleGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toRoleGrantResponse(grant))
+}
+
+// POST /admin/role-grants/:id/deny
+func (ac *AuthController) DenyRoleGrant(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	grant, err := ac.Service.DenyRoleGrant(currentActor(c), id)
+	if err != nil {
+		roleGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toRoleGrantResponse(grant))
+}
+
+// DELETE /admin/role-grants/:id
+func (ac *AuthController) RevokeRoleGrant(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	grant, err := ac.Service.RevokeRoleGrant(currentActor(c), id)
+	if err != nil {
+		roleGrantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toRoleGrantResponse(grant))
+}
+
+func roleGrantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, service.ErrUnknownGrant):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, service.ErrInvalidGrant), errors.Is(err, service.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfApproval), errors.Is(err, service.ErrNotApprover),
+		errors.Is(err, service.ErrSelfAdminEdit), errors.Is(err, service.ErrRoleNotGrantable),
+		errors.Is(err, service.ErrOrgScoped):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrGrantNotPending), errors.Is(err, service.ErrGrantNotActive),
+		errors.Is(err, service.ErrDuplicateRequest):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Role grant update failed"})
+	}
+}
@@ -0,0 +1,782 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/passpolicy"
+	"auth-service/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchSchema  = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSPConfSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimRTSchema     = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	// scimMaxResults caps the page size of list requests
+	scimMaxResults = 200
+)
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type scimName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	Formatted  string `json:"formatted,omitempty"`
+}
+
+type scimValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// scimUser is a SCIM User. userName is the user's email; emails and groups
+// are derived and ignored on writes, group membership is changed through
+// Groups.
+type scimUser struct {
+	Schemas    []string    `json:"schemas"`
+	ID         string      `json:"id,omitempty"`
+	ExternalID string      `json:"externalId,omitempty"`
+	UserName   string      `json:"userName"`
+	Name       *scimName   `json:"name,omitempty"`
+	Emails     []scimValue `json:"emails,omitempty"`
+	Active     *bool       `json:"active,omitempty"`
+	Password   string      `json:"password,omitempty"`
+	Groups     []scimValue `json:"groups,omitempty"`
+	Meta       *scimMeta   `json:"meta,omitempty"`
+}
+
+// scimGroup is a SCIM Group, which is a role here
+type scimGroup struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []scimValue `json:"members,omitempty"`
+	Meta        *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string `json:"schemas"`
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+func toSCIMUser(c *gin.Context, u *model.User, externalID string) scimUser {
+	active := u.DisabledAt == nil
+	out := scimUser{
+		Schemas:    []string{scimUserSchema},
+		ID:         strconv.FormatUint(uint64(u.ID), 10),
+		ExternalID: externalID,
+		UserName:   u.Email,
+		Name: &scimName{
+			GivenName:  u.FirstName,
+			FamilyName: u.LastName,
+			Formatted:  strings.TrimSpace(u.FirstName + " " + u.LastName),
+		},
+		Emails: []scimValue{{Value: u.Email, Type: "work", Primary: true}},
+		Active: &active,
+		Groups: []scimValue{},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     scimLocation(c, "Users", u.ID),
+		},
+	}
+	for _, r := range u.RoleList() {
+		out.Groups = append(out.Groups, scimValue{Value: r, Display: r})
+	}
+	return out
+}
+
+func toSCIMGroup(c *gin.Context, r *model.Role, members []model.User) scimGroup {
+	out := scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          strconv.FormatUint(uint64(r.ID), 10),
+		DisplayName: r.Name,
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      r.CreatedAt,
+			LastModified: r.UpdatedAt,
+			Location:     scimLocation(c, "Groups", r.ID),
+		},
+	}
+	for _, u := range members {
+		out.Members = append(out.Members, scimValue{
+			Value:   strconv.FormatUint(uint64(u.ID), 10),
+			Display: u.Email,
+			Ref:     scimLocation(c, "Users", u.ID),
+		})
+	}
+	return out
+}
+
+// toSCIMInput checks a User resource and turns it into what the service
+// stores
+func toSCIMInput(u *scimUser) (service.SCIMUser, error) {
+	in := service.SCIMUser{
+		Email:      strings.TrimSpace(u.UserName),
+		ExternalID: u.ExternalID,
+		Active:     u.Active == nil || *u.Active,
+		Password:   u.Password,
+	}
+	if u.Name != nil {
+		in.FirstName, in.LastName = u.Name.GivenName, u.Name.FamilyName
+	}
+	if !strings.Contains(in.Email, "@") {
+		return in, errors.New("userName must be the user's email address")
+	}
+	return in, nil
+}
+
+// GET /scim/v2/Users
+func (ac *AuthController) SCIMListUsers(c *gin.Context) {
+	page, ok := scimPage(c)
+	if !ok {
+		return
+	}
+	users, total, err := ac.Service.ListSCIMUsers(page)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	externalIDs, err := ac.Service.SCIMExternalIDs(users)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+
+	resources := make([]scimUser, len(users))
+	for i := range users {
+		resources[i] = toSCIMUser(c, &users[i], externalIDs[users[i].ID])
+	}
+	scimList(c, page, total, resources)
+}
+
+// GET /scim/v2/Users/:id
+func (ac *AuthController) SCIMGetUser(c *gin.Context) {
+	user, ok := ac.scimUser(c)
+	if !ok {
+		return
+	}
+	externalIDs, err := ac.Service.SCIMExternalIDs([]model.User{*user})
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(c, user, externalIDs[user.ID]))
+}
+
+// POST /scim/v2/Users
+func (ac *AuthController) SCIMCreateUser(c *gin.Context) {
+	var req scimUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	in, err := toSCIMInput(&req)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	user, err := ac.Service.CreateSCIMUser(currentActor(c), in)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	c.Header("Location", scimLocation(c, "Users", user.ID))
+	scimJSON(c, http.StatusCreated, toSCIMUser(c, user, in.ExternalID))
+}
+
+// PUT /scim/v2/Users/:id
+func (ac *AuthController) SCIMReplaceUser(c *gin.Context) {
+	user, ok := ac.scimUser(c)
+	if !ok {
+		return
+	}
+	var req scimUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	ac.replaceSCIMUser(c, user.ID, &req)
+}
+
+// PATCH /scim/v2/Users/:id
+func (ac *AuthController) SCIMPatchUser(c *gin.Context) {
+	user, ok := ac.scimUser(c)
+	if !ok {
+		return
+	}
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	externalIDs, err := ac.Service.SCIMExternalIDs([]model.User{*user})
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+
+	// Apply the operations to the current resource, then store it whole
+	current, _ := json.Marshal(toSCIMUser(c, user, externalIDs[user.ID]))
+	var doc map[string]interface{}
+	_ = json.Unmarshal(current, &doc)
+	for _, op := range req.Operations {
+		var value interface{}
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		}
+		if err := patchDocument(doc, op.Op, op.Path, value); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidPath", err.Error())
+			return
+		}
+	}
+	// Some clients send booleans as strings
+	if s, ok := doc["active"].(string); ok {
+		doc["active"] = strings.EqualFold(s, "true")
+	}
+
+	patched, _ := json.Marshal(doc)
+	var next scimUser
+	if err := json.Unmarshal(patched, &next); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	ac.replaceSCIMUser(c, user.ID, &next)
+}
+
+func (ac *AuthController) replaceSCIMUser(c *gin.Context, id uint, req *scimUser) {
+	in, err := toSCIMInput(req)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	user, err := ac.Service.ReplaceSCIMUser(currentActor(c), id, in)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(c, user, in.ExternalID))
+}
+
+// DELETE /scim/v2/Users/:id
+func (ac *AuthController) SCIMDeleteUser(c *gin.Context) {
+	user, ok := ac.scimUser(c)
+	if !ok {
+		return
+	}
+	if err := ac.Service.DeleteSCIMUser(currentActor(c), user.ID); err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /scim/v2/Groups
+func (ac *AuthController) SCIMListGroups(c *gin.Context) {
+	page, ok := scimPage(c)
+	if !ok {
+		return
+	}
+	roles, total, err := ac.Service.ListSCIMGroups(page)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+
+	withMembers := !strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+	resources := make([]scimGroup, len(roles))
+	for i := range roles {
+		var members []model.User
+		if withMembers {
+			if members, err = ac.Service.RoleMembers(roles[i].Name); err != nil {
+				scimServiceError(c, err)
+				return
+			}
+		}
+		resources[i] = toSCIMGroup(c, &roles[i], members)
+	}
+	scimList(c, page, total, resources)
+}
+
+// GET /scim/v2/Groups/:id
+func (ac *AuthController) SCIMGetGroup(c *gin.Context) {
+	role, ok := ac.scimGroup(c)
+	if !ok {
+		return
+	}
+	ac.writeSCIMGroup(c, http.StatusOK, role.ID)
+}
+
+// POST /scim/v2/Groups
+func (ac *AuthController) SCIMCreateGroup(c *gin.Context) {
+	var req scimGroup
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.DisplayName) == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	members, err := scimMemberIDs(req.Members)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	role, err := ac.Service.CreateSCIMGroup(currentActor(c), req.DisplayName, members)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	c.Header("Location", scimLocation(c, "Groups", role.ID))
+	ac.writeSCIMGroup(c, http.StatusCreated, role.ID)
+}
+
+// PUT /scim/v2/Groups/:id
+func (ac *AuthController) SCIMReplaceGroup(c *gin.Context) {
+	role, ok := ac.scimManagedGroup(c)
+	if !ok {
+		return
+	}
+	var req scimGroup
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.DisplayName) == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	members, err := scimMemberIDs(req.Members)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	actor := currentActor(c)
+	if role, err = ac.Service.RenameRole(actor, role.ID, req.DisplayName); err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	if err := ac.Service.SetRoleMembers(actor, role.Name, members); err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	ac.writeSCIMGroup(c, http.StatusOK, role.ID)
+}
+
+// PATCH /scim/v2/Groups/:id
+func (ac *AuthController) SCIMPatchGroup(c *gin.Context) {
+	role, ok := ac.scimManagedGroup(c)
+	if !ok {
+		return
+	}
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	actor := currentActor(c)
+	for _, op := range req.Operations {
+		verb := strings.ToLower(op.Op)
+		path := strings.TrimSpace(op.Path)
+		var err error
+
+		switch {
+		// {"op":"replace","value":{"displayName":"...","members":[...]}}
+		case path == "" && (verb == "replace" || verb == "add"):
+			var value struct {
+				DisplayName string       `json:"displayName"`
+				Members     *[]scimValue `json:"members"`
+			}
+			if err = json.Unmarshal(op.Value, &value); err != nil {
+				break
+			}
+			if value.DisplayName != "" {
+				if role, err = ac.Service.RenameRole(actor, role.ID, value.DisplayName); err != nil {
+					break
+				}
+			}
+			if value.Members != nil {
+				err = ac.patchMembers(actor, role.Name, verb, *value.Members)
+			}
+
+		case strings.EqualFold(path, "displayName"):
+			var name string
+			if err = json.Unmarshal(op.Value, &name); err == nil {
+				role, err = ac.Service.RenameRole(actor, role.ID, name)
+			}
+
+		case strings.EqualFold(path, "members"):
+			var members []scimValue
+			if len(op.Value) > 0 {
+				if err = json.Unmarshal(op.Value, &members); err != nil {
+					break
+				}
+			}
+			if verb == "remove" && len(members) == 0 {
+				// Removing the attribute empties the group
+				verb = "replace"
+			}
+			err = ac.patchMembers(actor, role.Name, verb, members)
+
+		// {"op":"remove","path":"members[value eq \"42\"]"}
+		case verb == "remove" && strings.HasPrefix(strings.ToLower(path), "members["):
+			var id uint
+			if id, err = scimMemberFilter(path); err == nil {
+				err = ac.Service.RemoveRoleMembers(actor, role.Name, []uint{id})
+			}
+
+		default:
+			scimError(c, http.StatusBadRequest, "invalidPath", "unsupported path: "+path)
+			return
+		}
+
+		if err != nil {
+			scimServiceError(c, err)
+			return
+		}
+	}
+
+	if c.Query("excludedAttributes") != "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	ac.writeSCIMGroup(c, http.StatusOK, role.ID)
+}
+
+func (ac *AuthController) patchMembers(actor service.Actor, role, verb string, members []scimValue) error {
+	ids, err := scimMemberIDs(members)
+	if err != nil {
+		return err
+	}
+	switch verb {
+	case "add":
+		return ac.Service.AddRoleMembers(actor, role, ids)
+	case "remove":
+		return ac.Service.RemoveRoleMembers(actor, role, ids)
+	case "replace":
+		return ac.Service.SetRoleMembers(actor, role, ids)
+	}
+	return fmt.Errorf("%w: unknown op %q", errSCIMBadValue, verb)
+}
+
+// DELETE /scim/v2/Groups/:id
+func (ac *AuthController) SCIMDeleteGroup(c *gin.Context) {
+	role, ok := ac.scimManagedGroup(c)
+	if !ok {
+		return
+	}
+	if err := ac.Service.DeleteSCIMGroup(currentActor(c), role.ID); err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /scim/v2/ServiceProviderConfig
+func (ac *AuthController) SCIMServiceProviderConfig(c *gin.Context) {
+	supported := func(ok bool) gin.H { return gin.H{"supported": ok} }
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimSPConfSchema},
+		"patch":          supported(true),
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": supported(true),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A service account API key or an access token holding scim:write",
+			"primary":     true,
+		}},
+	})
+}
+
+// GET /scim/v2/ResourceTypes
+func (ac *AuthController) SCIMResourceTypes(c *gin.Context) {
+	types := []gin.H{
+		{"schemas": []string{scimRTSchema}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scimUserSchema},
+		{"schemas": []string{scimRTSchema}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scimGroupSchema},
+	}
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": len(types),
+		"startIndex":   1,
+		"itemsPerPage": len(types),
+		"Resources":    types,
+	})
+}
+
+func (ac *AuthController) writeSCIMGroup(c *gin.Context, status int, id uint) {
+	role, err := ac.Service.GetRole(id)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	members, err := ac.Service.RoleMembers(role.Name)
+	if err != nil {
+		scimServiceError(c, err)
+		return
+	}
+	scimJSON(c, status, toSCIMGroup(c, role, members))
+}
+
+// scimUser loads the user named by the :id parameter, answering 404 itself
+func (ac *AuthController) scimUser(c *gin.Context) (*model.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	user, err := ac.Service.GetUser(uint(id))
+	if err != nil {
+		scimServiceError(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// scimGroup loads the role named by the :id parameter, answering 404 itself
+func (ac *AuthController) scimGroup(c *gin.Context) (*model.Role, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return nil, false
+	}
+	role, err := ac.Service.GetSCIMGroup(uint(id))
+	if err != nil {
+		scimServiceError(c, err)
+		return nil, false
+	}
+	return role, true
+}
+
+// scimManagedGroup is scimGroup for changes. Nobody can hand out a role
+// granting more than they hold themselves.
+func (ac *AuthController) scimManagedGroup(c *gin.Context) (*model.Role, bool) {
+	role, ok := ac.scimGroup(c)
+	if !ok {
+		return nil, false
+	}
+	claims := currentClaims(c)
+	for _, p := range role.Permissions {
+		if !claims.HasPermission(p.Name) {
+			scimError(c, http.StatusForbidden, "", "cannot manage a group granting a permission you don't have: "+p.Name)
+			return nil, false
+		}
+	}
+	return role, true
+}
+
+var errSCIMBadValue = errors.New("invalid value")
+
+func scimMemberIDs(members []scimValue) ([]uint, error) {
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: member %q is not a user id", errSCIMBadValue, m.Value)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// scimMemberFilter reads the user id out of a path like members[value eq "42"]
+func scimMemberFilter(path string) (uint, error) {
+	inner := path[strings.Index(path, "[")+1:]
+	inner = strings.TrimSuffix(strings.TrimSpace(inner), "]")
+	fields := strings.Fields(inner)
+	if len(fields) != 3 || !strings.EqualFold(fields[0], "value") || !strings.EqualFold(fields[1], "eq") {
+		return 0, fmt.Errorf("%w: unsupported member filter %q", errSCIMBadValue, path)
+	}
+	id, err := strconv.ParseUint(strings.Trim(fields[2], `"`), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: member %s is not a user id", errSCIMBadValue, fields[2])
+	}
+	return uint(id), nil
+}
+
+// patchDocument applies one PATCH operation to a resource decoded as JSON.
+// Only simple paths ("active", "name.givenName") are supported; attribute
+// names match case-insensitively, as SCIM requires.
+func patchDocument(doc map[string]interface{}, op, path string, value interface{}) error {
+	op = strings.ToLower(op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return fmt.Errorf("unsupported op %q", op)
+	}
+
+	if path == "" {
+		if op == "remove" {
+			return errors.New("remove needs a path")
+		}
+		attrs, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.New("an operation without path needs an object value")
+		}
+		for k, v := range attrs {
+			if err := patchDocument(doc, op, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Drop a schema URN prefix such as urn:ietf:params:scim:schemas:core:2.0:User:name.givenName
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		path = path[i+1:]
+	}
+	if strings.ContainsAny(path, "[]") {
+		// emails[type eq "work"].value and the like; emails follow userName
+		return fmt.Errorf("filtered path %q is not supported", path)
+	}
+
+	parts := strings.Split(path, ".")
+	target := doc
+	for _, p := range parts[:len(parts)-1] {
+		key := docKey(target, p)
+		child, ok := target[key].(map[string]interface{})
+		if !ok {
+			if op == "remove" {
+				return nil
+			}
+			child = map[string]interface{}{}
+			target[key] = child
+		}
+		target = child
+	}
+
+	key := docKey(target, parts[len(parts)-1])
+	if op == "remove" {
+		delete(target, key)
+		return nil
+	}
+	// A dotted key at the top level sets the sub-attribute
+	if obj, ok := value.(map[string]interface{}); ok {
+		if existing, ok := target[key].(map[string]interface{}); ok {
+			for k, v := range obj {
+				existing[docKey(existing, k)] = v
+			}
+			return nil
+		}
+	}
+	target[key] = value
+	return nil
+}
+
+// docKey finds the key of doc matching name case-insensitively
+func docKey(doc map[string]interface{}, name string) string {
+	for k := range doc {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+// scimPage reads filter, startIndex and count, answering 400 itself
+func scimPage(c *gin.Context) (service.SCIMPage, bool) {
+	page := service.SCIMPage{Filter: strings.TrimSpace(c.Query("filter")), Limit: scimMaxResults}
+	if v := c.Query("startIndex"); v != "" {
+		start, err := strconv.Atoi(v)
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", "startIndex must be a number")
+			return page, false
+		}
+		if start > 1 {
+			page.Offset = start - 1
+		}
+	}
+	if v := c.Query("count"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", "count must be a number")
+			return page, false
+		}
+		if count < 0 {
+			count = 0
+		}
+		if count < page.Limit {
+			page.Limit = count
+		}
+	}
+	return page, true
+}
+
+func scimList[T any](c *gin.Context, page service.SCIMPage, total int64, resources []T) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   page.Offset + 1,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+func scimLocation(c *gin.Context, resource string, id uint) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%d", scheme, c.Request.Host, resource, id)
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json; charset=utf-8")
+	c.JSON(status, body)
+}
+
+// scimError answers in the error format of RFC 7644 section 3.12
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func scimServiceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, service.ErrUnknownRole):
+		scimError(c, http.StatusNotFound, "", "resource not found")
+	case errors.Is(err, service.ErrPrivilegedUser):
+		scimError(c, http.StatusForbidden, "", err.Error())
+	case errors.Is(err, service.ErrInvalidFilter):
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+	case errors.Is(err, errSCIMBadValue), errors.As(err, new(*passpolicy.Error)):
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, service.ErrEmailTaken), errors.Is(err, service.ErrExternalIDTaken), errors.Is(err, service.ErrRoleExists):
+		scimError(c, http.StatusConflict, "uniqueness", err.Error())
+	default:
+		scimError(c, http.StatusInternalServerError, "", "internal error")
+	}
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func scimDoc(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"userName": "jane@example.com",
+		"active": true,
+		"name": {"givenName": "Jane", "familyName": "Doe"}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestPatchDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    string
+		path  string
+		value interface{}
+		check func(map[string]interface{}) bool
+	}{
+		{"replace top level", "replace", "active", false,
+			func(d map[string]interface{}) bool { return d["active"] == false }},
+		{"op and attribute case", "Replace", "ACTIVE", false,
+			func(d map[string]interface{}) bool { return d["active"] == false && len(d) == 3 }},
+		{"sub-attribute", "replace", "name.givenName", "Janet",
+			func(d map[string]interface{}) bool {
+				return name(d)["givenName"] == "Janet" && name(d)["familyName"] == "Doe"
+			}},
+		{"schema urn", "replace", "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName", "Roe",
+			func(d map[string]interface{}) bool { return name(d)["familyName"] == "Roe" }},
+		{"merge into complex", "add", "name", map[string]interface{}{"familyname": "Roe"},
+			func(d map[string]interface{}) bool {
+				return name(d)["givenName"] == "Jane" && name(d)["familyName"] == "Roe"
+			}},
+		{"add new complex", "add", "title.main", "Engineer",
+			func(d map[string]interface{}) bool {
+				title, _ := d["title"].(map[string]interface{})
+				return title["main"] == "Engineer"
+			}},
+		{"remove", "remove", "name.givenName", nil,
+			func(d map[string]interface{}) bool { _, ok := name(d)["givenName"]; return !ok }},
+		{"remove missing parent", "remove", "title.main", nil,
+			func(d map[string]interface{}) bool { _, ok := d["title"]; return !ok }},
+		{"no path", "replace", "", map[string]interface{}{"active": false, "name.givenName": "Janet"},
+			func(d map[string]interface{}) bool { return d["active"] == false && name(d)["givenName"] == "Janet" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := scimDoc(t)
+			if err := patchDocument(doc, tt.op, tt.path, tt.value); err != nil {
+				t.Fatalf("patchDocument: %v", err)
+			}
+			if !tt.check(doc) {
+				out, _ := json.Marshal(doc)
+				t.Errorf("unexpected result %s", out)
+			}
+		})
+	}
+}
+
+func name(doc map[string]interface{}) map[string]interface{} {
+	n, _ := doc["name"].(map[string]interface{})
+	return n
+}
+
+func TestPatchDocumentRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    string
+		path  string
+		value interface{}
+	}{
+		{"unknown op", "move", "active", true},
+		{"remove without path", "remove", "", nil},
+		{"no path, no object", "replace", "", "jane"},
+		{"filtered path", "replace", `emails[type eq "work"].value`, "x@example.com"},
+		{"filter with urn", "replace", `urn:ietf:params:scim:schemas:core:2.0:User:emails[primary eq true].value`, "x"},
+		{"bare filter", "remove", `emails[value eq "jane@example.com"]`, nil},
+		{"filter inside no-path value", "replace", "", map[string]interface{}{`emails[type eq "work"].value`: "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := scimDoc(t)
+			before, _ := json.Marshal(doc)
+			if err := patchDocument(doc, tt.op, tt.path, tt.value); err == nil {
+				t.Fatal("accepted")
+			}
+			if after, _ := json.Marshal(doc); string(after) != string(before) {
+				t.Errorf("rejected operation changed the document to %s", after)
+			}
+		})
+	}
+}
+
+func TestSCIMMemberFilter(t *testing.T) {
+	for path, want := range map[string]uint{
+		`members[value eq "42"]`:  42,
+		`members[VALUE EQ "7"]`:   7,
+		`members[ value eq 9 ]`:   9,
+		`Members[value eq "100"]`: 100,
+	} {
+		got, err := scimMemberFilter(path)
+		if err != nil || got != want {
+			t.Errorf("%s: got %d, %v; want %d", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{
+		`members[display eq "Jane"]`,
+		`members[value ne "42"]`,
+		`members[value eq "jane"]`,
+		`members[value eq "1" or value eq "2"]`,
+		`members[]`,
+	} {
+		if _, err := scimMemberFilter(path); !errors.Is(err, errSCIMBadValue) {
+			t.Errorf("%s: err = %v, want errSCIMBadValue", path, err)
+		}
+	}
+}
+
+func TestSCIMMemberIDs(t *testing.T) {
+	ids, err := scimMemberIDs([]scimValue{{Value: "3"}, {Value: "5"}})
+	if err != nil || !reflect.DeepEqual(ids, []uint{3, 5}) {
+		t.Errorf("got %v, %v", ids, err)
+	}
+	if _, err := scimMemberIDs([]scimValue{{Value: "jane"}}); !errors.Is(err, errSCIMBadValue) {
+		t.Errorf("non-numeric member: err = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"auth-service/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type securityEventResponse struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Kind      string    `json:"kind"`
+	Signals   []string  `json:"signals"`
+	Score     int       `json:"score"`
+	StepUp    bool      `json:"step_up"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Location  string    `json:"location,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toSecurityEventResponses(events []model.SecurityEvent) []securityEventResponse {
+	out := make([]securityEventResponse, len(events))
+	for i := range events {
+		e := &events[i]
+		out[i] = securityEventResponse{
+			ID:        e.ID,
+			UserID:    e.UserID,
+			Kind:      e.Kind,
+			Signals:   e.SignalList(),
+			Score:     e.Score,
+			StepUp:    e.StepUp,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Location:  e.Location,
+			CreatedAt: e.CreatedAt,
+		}
+	}
+	return out
+}
+
+// GET /security-events
+func (ac *AuthController) ListMySecurityEvents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := ac.Service.ListSecurityEvents(currentClaims(c).UserID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list security events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": toSecurityEventResponses(events)})
+}
+
+// GET /admin/security-events
+func (ac *AuthController) ListSecurityEvents(c *gin.Context) {
+	var userID uint
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID = uint(id)
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	events, err := ac.Service.ListSecurityEvents(userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list security events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": toSecurityEventResponses(events)})
+}
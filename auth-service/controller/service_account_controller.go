@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type serviceAccountResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type apiKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func toServiceAccountResponse(a *model.ServiceAccount) serviceAccountResponse {
+	return serviceAccountResponse{
+		ID:          a.ID,
+		Name:        a.Name,
+		Description: a.Description,
+		CreatedAt:   a.CreatedAt,
+	}
+}
+
+func toAPIKeyResponse(k *model.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+// POST /admin/service-accounts
+func (ac *AuthController) CreateServiceAccount(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := ac.Service.CreateServiceAccount(currentActor(c), req.Name, req.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+	c.JSON(http.StatusCreated, toServiceAccountResponse(account))
+}
+
+// GET /admin/service-accounts
+func (ac *AuthController) ListServiceAccounts(c *gin.Context) {
+	accounts, err := ac.Service.ListServiceAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts"})
+		return
+	}
+
+	out := make([]serviceAccountResponse, len(accounts))
+	for i := range accounts {
+		out[i] = toServiceAccountResponse(&accounts[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"service_accounts": out})
+}
+
+// DELETE /admin/service-accounts/:id
+func (ac *AuthController) DeleteServiceAccount(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.DeleteServiceAccount(currentActor(c), id); err != nil {
+		serviceAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted"})
+}
+
+// POST /admin/service-accounts/:id/keys
+func (ac *AuthController) CreateAPIKey(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes" binding:"required"`
+		ExpiresIn string   `json:"expires_in"` // e.g. "720h", defaults to the configured TTL
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a positive duration like 720h"})
+			return
+		}
+		ttl = d
+	}
+
+	key, secret, err := ac.Service.CreateAPIKey(currentActor(c), id, req.Name, req.Scopes, ttl)
+	if err != nil {
+		serviceAccountError(c, err)
+		return
+	}
+
+	resp := toAPIKeyResponse(key)
+	resp.Key = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GET /admin/service-accounts/:id/keys
+func (ac *AuthController) ListAPIKeys(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	keys, err := ac.Service.ListAPIKeys(id)
+	if err != nil {
+		serviceAccountError(c, err)
+		return
+	}
+
+	out := make([]apiKeyResponse, len(keys))
+	for i := range keys {
+		out[i] = toAPIKeyResponse(&keys[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": out})
+}
+
+// DELETE /admin/service-accounts/:id/keys/:keyId
+func (ac *AuthController) RevokeAPIKey(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	keyID, ok := idParam(c, "keyId")
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.RevokeAPIKey(currentActor(c), id, keyID); err != nil {
+		serviceAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// idParam parses a numeric path parameter, answering 400 itself when it isn't one
+func idParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func serviceAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, service.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope"})
+	case errors.Is(err, service.ErrScopeNotHeld):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Service account update failed"})
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+	// ImpersonatorID is the admin acting as the user in this session
+	ImpersonatorID *uint `json:"impersonator_id,omitempty"`
+}
+
+func toSessionResponses(sessions []model.Session, currentID string) []sessionResponse {
+	out := make([]sessionResponse, len(sessions))
+	for i, s := range sessions {
+		out[i] = sessionResponse{
+			ID:             s.ID,
+			UserAgent:      s.UserAgent,
+			IP:             s.IP,
+			CreatedAt:      s.CreatedAt,
+			LastSeenAt:     s.LastSeenAt,
+			ExpiresAt:      s.ExpiresAt,
+			Current:        s.ID == currentID,
+			ImpersonatorID: s.ImpersonatorID,
+		}
+	}
+	return out
+}
+
+// GET /sessions
+func (ac *AuthController) ListMySessions(c *gin.Context) {
+	claims := currentClaims(c)
+	sessions, err := ac.Service.ListSessions(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": toSessionResponses(sessions, claims.ID)})
+}
+
+// DELETE /sessions/:sessionId
+func (ac *AuthController) RevokeMySession(c *gin.Context) {
+	actor := currentActor(c)
+	if err := ac.Service.RevokeSession(actor, actor.UserID, c.Param("sessionId")); err != nil {
+		sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// GET /admin/users/:id/sessions
+func (ac *AuthController) ListUserSessions(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if _, err := ac.Service.AdminUser(currentActor(c), id); err != nil {
+		sessionError(c, err)
+		return
+	}
+	sessions, err := ac.Service.ListSessions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": toSessionResponses(sessions, currentClaims(c).ID)})
+}
+
+// DELETE /admin/users/:id/sessions/:sessionId
+func (ac *AuthController) RevokeUserSession(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.RevokeSession(currentActor(c), id, c.Param("sessionId")); err != nil {
+		sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// DELETE /admin/users/:id/sessions
+func (ac *AuthController) RevokeUserSessions(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.RevokeAllSessions(currentActor(c), id); err != nil {
+		sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked"})
+}
+
+func sessionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrOrgScoped):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Session revocation failed"})
+	}
+}
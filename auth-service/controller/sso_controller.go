@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ssoStateCookie binds a sign-on to the browser that started it
+const ssoStateCookie = "sso_state"
+
+// GET /sso/login
+func (ac *AuthController) SSOLogin(c *gin.Context) {
+	redirect, state, err := ac.Service.StartSSOLogin()
+	if err != nil {
+		if errors.Is(err, service.ErrSSODisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	// Lax, not Strict: the provider sends the browser back with a top-level GET
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, state, int(service.SSOLoginTTL.Seconds()), "/sso", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// GET /sso/callback
+func (ac *AuthController) SSOCallback(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in was cancelled or refused: " + e})
+		return
+	}
+
+	state := c.Query("state")
+	cookie, err := c.Cookie(ssoStateCookie)
+	if state == "" || err != nil || cookie != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrInvalidSSOState.Error()})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, "", -1, "/sso", "", c.Request.TLS != nil, true)
+
+	result, err := ac.Service.CompleteSSOLogin(state, c.Query("code"), clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSSODisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidSSOState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrSSOFailed):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrSSOFailed.Error()})
+		case errors.Is(err, service.ErrNoAccount), errors.Is(err, service.ErrUserDisabled),
+			errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrNotMember):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUnverifiedEmail), errors.Is(err, service.ErrPrivilegedLink):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Sign-in failed"})
+		}
+		return
+	}
+
+	if result.MFAToken != "" {
+		mfaExpiry := int64(service.MFAChallengeTTL.Seconds())
+		if service.SSOSuccessURL == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				"mfa_token":    result.MFAToken,
+				"mfa_method":   result.MFAMethod,
+				"expires_in":   mfaExpiry,
+			})
+			return
+		}
+		fragment := url.Values{
+			"mfa_required": {"true"},
+			"mfa_token":    {result.MFAToken},
+			"mfa_method":   {result.MFAMethod},
+			"expires_in":   {strconv.FormatInt(mfaExpiry, 10)},
+		}
+		c.Redirect(http.StatusFound, service.SSOSuccessURL+"#"+fragment.Encode())
+		return
+	}
+
+	pair := result.Tokens
+	if service.SSOSuccessURL == "" {
+		c.JSON(http.StatusOK, tokenResponse(pair))
+		return
+	}
+	// The fragment never reaches servers or their logs
+	fragment := url.Values{
+		"token":         {pair.AccessToken},
+		"refresh_token": {pair.RefreshToken},
+		"token_type":    {"Bearer"},
+		"expires_in":    {strconv.FormatInt(pair.ExpiresIn, 10)},
+	}
+	c.Redirect(http.StatusFound, service.SSOSuccessURL+"#"+fragment.Encode())
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"auth-service/model"
+	"auth-service/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type userResponse struct {
+	ID         uint       `json:"id"`
+	Email      string     `json:"email"`
+	FirstName  string     `json:"first_name"`
+	LastName   string     `json:"last_name"`
+	Roles      []string   `json:"roles"`
+	MFAEnabled bool       `json:"mfa_enabled"`
+	LockedAt   *time.Time `json:"locked_at,omitempty"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func toUserResponse(u *model.User) userResponse {
+	return userResponse{
+		ID:         u.ID,
+		Email:      u.Email,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		Roles:      u.RoleList(),
+		MFAEnabled: u.MFAEnabled,
+		LockedAt:   u.LockedAt,
+		DisabledAt: u.DisabledAt,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+	}
+}
+
+// GET /admin/users
+func (ac *AuthController) ListUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	filter := service.UserFilter{
+		Query:    c.Query("q"),
+		Role:     c.Query("role"),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	filter.Normalize()
+
+	users, total, err := ac.Service.ListUsers(currentActor(c), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	out := make([]userResponse, len(users))
+	for i := range users {
+		out[i] = toUserResponse(&users[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"users":     out,
+		"page":      filter.Page,
+		"page_size": filter.PageSize,
+		"total":     total,
+	})
+}
+
+// GET /admin/users/:id
+func (ac *AuthController) GetUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := ac.Service.AdminUser(currentActor(c), id)
+	if err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toUserResponse(user))
+}
+
+// PUT /admin/users/:id/roles
+func (ac *AuthController) SetUserRoles(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Roles []string `json:"roles" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.Service.SetUserRoles(currentActor(c), id, req.Roles)
+	if err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toUserResponse(user))
+}
+
+// POST /admin/users/:id/disable
+func (ac *AuthController) DisableUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.DisableUser(currentActor(c), id); err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+}
+
+// POST /admin/users/:id/enable
+func (ac *AuthController) EnableUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.EnableUser(currentActor(c), id); err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+}
+
+// DELETE /admin/users/:id
+func (ac *AuthController) DeleteUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.DeleteUser(currentActor(c), id); err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// POST /admin/users/:id/unlock
+func (ac *AuthController) UnlockUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.UnlockUser(currentActor(c), id); err != nil {
+		userAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// userIDParam parses :id, answering 400 itself when it isn't a number
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func userAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrSelfAdminEdit):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleNotGrantable), errors.Is(err, service.ErrOrgScoped):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User update failed"})
+	}
+}
@@ -0,0 +1,234 @@
+// Package directory authenticates users against an LDAP server or Active
+// Directory: it searches for the user with a service account, then binds as
+// them to check the password.
+package directory
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found in directory")
+	ErrInvalidCredentials = errors.New("invalid directory credentials")
+)
+
+// Config describes where and how to look users up. Only URL and BaseDN are
+// required; the rest defaults to what suits OpenLDAP with the memberOf
+// overlay. For Active Directory set UserFilter to
+// "(sAMAccountName={username})" and IDAttr to "objectGUID".
+type Config struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+
+	// BindDN and BindPassword are the service account searching for users.
+	// Empty searches anonymously.
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter finds the user; {username} is replaced with the escaped login
+	UserFilter string
+	// IDAttr holds a stable identifier for the user. Empty uses the DN,
+	// which changes when the user is moved or renamed.
+	IDAttr        string
+	EmailAttr     string
+	FirstNameAttr string
+	LastNameAttr  string
+	// GroupAttr lists the user's group DNs on the user entry
+	GroupAttr string
+	// GroupBaseDN, when set, also searches for groups there with
+	// GroupFilter; {dn} is replaced with the escaped user DN
+	GroupBaseDN string
+	GroupFilter string
+
+	Timeout time.Duration
+}
+
+// Entry is the user as the directory describes them
+type Entry struct {
+	DN        string
+	ID        string
+	Email     string
+	FirstName string
+	LastName  string
+	// Groups holds the DN of every group the user is in, followed by the
+	// group's own name (the value of its first RDN), so roles can be mapped
+	// from either
+	Groups []string
+}
+
+// Client is a configured directory. It opens a connection per call.
+type Client struct {
+	Config Config
+}
+
+// New returns a client for cfg with the defaults filled in
+func New(cfg Config) *Client {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(&(objectClass=person)(|(uid={username})(mail={username})))"
+	}
+	if cfg.EmailAttr == "" {
+		cfg.EmailAttr = "mail"
+	}
+	if cfg.FirstNameAttr == "" {
+		cfg.FirstNameAttr = "givenName"
+	}
+	if cfg.LastNameAttr == "" {
+		cfg.LastNameAttr = "sn"
+	}
+	if cfg.GroupAttr == "" {
+		cfg.GroupAttr = "memberOf"
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = "(|(member={dn})(uniqueMember={dn}))"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Client{Config: cfg}
+}
+
+// Authenticate looks username up and checks password by binding as them.
+// With ErrInvalidCredentials the entry is still returned, so the caller can
+// tell whose password was wrong.
+func (c *Client) Authenticate(username, password string) (*Entry, error) {
+	username = strings.TrimSpace(username)
+	// An empty password makes an unauthenticated bind, which servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if c.Config.BindDN != "" {
+		if err := conn.Bind(c.Config.BindDN, c.Config.BindPassword); err != nil {
+			return nil, fmt.Errorf("directory service bind: %w", err)
+		}
+	}
+
+	entry, err := c.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if c.Config.GroupBaseDN != "" {
+		groups, err := c.findGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+	entry.Groups = withGroupNames(entry.Groups)
+
+	// Everything is read, so the connection can now be spent on the user
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return entry, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("directory user bind: %w", err)
+	}
+	return entry, nil
+}
+
+func (c *Client) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.Config.InsecureSkipVerify}
+	conn, err := ldap.DialURL(c.Config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("directory connect: %w", err)
+	}
+	conn.SetTimeout(c.Config.Timeout)
+	if c.Config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("directory starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *Client) findUser(conn *ldap.Conn, username string) (*Entry, error) {
+	attrs := []string{c.Config.EmailAttr, c.Config.FirstNameAttr, c.Config.LastNameAttr, c.Config.GroupAttr}
+	if c.Config.IDAttr != "" {
+		attrs = append(attrs, c.Config.IDAttr)
+	}
+	filter := strings.ReplaceAll(c.Config.UserFilter, "{username}", ldap.EscapeFilter(username))
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		c.Config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(c.Config.Timeout.Seconds()), false, filter, attrs, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("directory user search: %w", err)
+	}
+	switch {
+	case res == nil || len(res.Entries) == 0:
+		return nil, ErrUserNotFound
+	case len(res.Entries) > 1:
+		// Don't guess which one is meant
+		return nil, fmt.Errorf("directory user search: %q matches several entries", username)
+	}
+
+	e := res.Entries[0]
+	entry := &Entry{
+		DN:        e.DN,
+		ID:        e.DN,
+		Email:     e.GetEqualFoldAttributeValue(c.Config.EmailAttr),
+		FirstName: e.GetEqualFoldAttributeValue(c.Config.FirstNameAttr),
+		LastName:  e.GetEqualFoldAttributeValue(c.Config.LastNameAttr),
+		Groups:    e.GetEqualFoldAttributeValues(c.Config.GroupAttr),
+	}
+	if c.Config.IDAttr != "" {
+		raw := e.GetEqualFoldRawAttributeValue(c.Config.IDAttr)
+		if len(raw) == 0 {
+			return nil, fmt.Errorf("directory entry %s has no %s", e.DN, c.Config.IDAttr)
+		}
+		// objectGUID and friends are binary
+		if utf8.Valid(raw) {
+			entry.ID = string(raw)
+		} else {
+			entry.ID = hex.EncodeToString(raw)
+		}
+	}
+	return entry, nil
+}
+
+func (c *Client) findGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	filter := strings.ReplaceAll(c.Config.GroupFilter, "{dn}", ldap.EscapeFilter(userDN))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		c.Config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(c.Config.Timeout.Seconds()), false, filter, []string{"1.1"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("directory group search: %w", err)
+	}
+	groups := make([]string, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+// withGroupNames adds the name of each group after the group DNs
+func withGroupNames(dns []string) []string {
+	out := append([]string(nil), dns...)
+	for _, g := range dns {
+		dn, err := ldap.ParseDN(g)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			continue
+		}
+		out = append(out, dn.RDNs[0].Attributes[0].Value)
+	}
+	return out
+}
@@ -0,0 +1,302 @@
+// Package directorytest runs an in-process LDAP server for exercising the
+// directory package, the way net/http/httptest does for HTTP. It speaks just
+// enough LDAPv3 for directory.Client: simple bind, search with the common
+// filters, and unbind. Attribute and DN matching is case-insensitive.
+package directorytest
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry is one object in the directory. Entries with a Password can be
+// bound as.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is a running test directory
+type Server struct {
+	// URL is the ldap:// URL to connect to
+	URL string
+
+	listener net.Listener
+	mu       sync.RWMutex
+	entries  []Entry
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a directory holding entries on a loopback port
+func NewServer(entries ...Entry) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("directorytest: failed to listen: " + err.Error())
+	}
+	s := &Server{URL: "ldap://" + l.Addr().String(), listener: l, entries: entries}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Add adds entries to the running directory
+func (s *Server) Add(entries ...Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entries...)
+}
+
+// Close stops the server and waits for open connections to end
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = []*ber.Packet{s.bind(op)}
+		case ldap.ApplicationSearchRequest:
+			responses = s.search(op)
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationExtendedRequest:
+			// StartTLS and friends
+			responses = []*ber.Packet{result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "extended operations are not supported")}
+		default:
+			responses = []*ber.Packet{result(uint8(op.Tag)+1, ldap.LDAPResultUnwillingToPerform, "operation not supported")}
+		}
+
+		for _, r := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+			envelope.AppendChild(r)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(op *ber.Packet) *ber.Packet {
+	const code = ldap.ApplicationBindResponse
+	if len(op.Children) < 3 || op.Children[2].ClassType != ber.ClassContext || op.Children[2].Tag != 0 {
+		return result(code, ldap.LDAPResultAuthMethodNotSupported, "only simple bind is supported")
+	}
+	dn, password := str(op.Children[1]), str(op.Children[2])
+	if password == "" {
+		// Anonymous or unauthenticated bind
+		return result(code, ldap.LDAPResultSuccess, "")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.entries {
+		if strings.EqualFold(e.DN, dn) && e.Password != "" && e.Password == password {
+			return result(code, ldap.LDAPResultSuccess, "")
+		}
+	}
+	return result(code, ldap.LDAPResultInvalidCredentials, "invalid credentials")
+}
+
+func (s *Server) search(op *ber.Packet) []*ber.Packet {
+	const code = ldap.ApplicationSearchResultDone
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(code, ldap.LDAPResultProtocolError, "malformed search")}
+	}
+	base := strings.ToLower(str(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var wanted []string
+	for _, a := range op.Children[7].Children {
+		wanted = append(wanted, str(a))
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*ber.Packet
+	for _, e := range s.entries {
+		if !inScope(strings.ToLower(e.DN), base, scope) || !matches(filter, e) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(out)) == sizeLimit {
+			return append(out, result(code, ldap.LDAPResultSizeLimitExceeded, ""))
+		}
+		out = append(out, entryPacket(e, wanted))
+	}
+	return append(out, result(code, ldap.LDAPResultSuccess, ""))
+}
+
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		_, parent, _ := strings.Cut(dn, ",")
+		return parent == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+// matches evaluates an RFC 4511 filter against e
+func matches(f *ber.Packet, e Entry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !matches(c, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if matches(c, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !matches(f.Children[0], e)
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		if len(f.Children) != 2 {
+			return false
+		}
+		want := str(f.Children[1])
+		for _, v := range values(e, str(f.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		attr := str(f)
+		return strings.EqualFold(attr, "objectClass") || len(values(e, attr)) > 0
+	case ldap.FilterSubstrings:
+		if len(f.Children) != 2 {
+			return false
+		}
+		for _, v := range values(e, str(f.Children[0])) {
+			if substringMatch(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func substringMatch(v string, parts []*ber.Packet) bool {
+	for _, p := range parts {
+		sub := strings.ToLower(str(p))
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, sub) {
+				return false
+			}
+			v = v[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, sub)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(v, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func values(e Entry, attr string) []string {
+	for name, vals := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return vals
+		}
+	}
+	return nil
+}
+
+func entryPacket(e Entry, wanted []string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, vals := range e.Attributes {
+		if !wantedAttr(name, wanted) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+// wantedAttr applies the requested attribute list: none or "*" means all,
+// "1.1" means none
+func wantedAttr(name string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == "*" || strings.EqualFold(w, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag uint8, code uint16, message string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ber.Tag(tag), nil, "Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return p
+}
+
+// str is the content of a primitive packet as a string
+func str(p *ber.Packet) string {
+	if p.Data == nil {
+		return ""
+	}
+	return p.Data.String()
+}
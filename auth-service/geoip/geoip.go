@@ -0,0 +1,155 @@
+// Package geoip locates IP addresses with a local database file, so login
+// risk checks never send addresses to a third party.
+//
+// The file is CSV with one network per line:
+//
+//	network,country,city,latitude,longitude
+//	81.2.69.0/24,GB,London,51.5142,-0.0931
+//
+// A header line starting with "network" and lines starting with # are
+// skipped. Networks must not overlap.
+package geoip
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Location is where an address is registered
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// String is "City, Country", or whichever of the two is known
+func (l Location) String() string {
+	switch {
+	case l.City != "" && l.Country != "":
+		return l.City + ", " + l.Country
+	case l.City != "":
+		return l.City
+	}
+	return l.Country
+}
+
+type block struct {
+	first, last netip.Addr
+	loc         Location
+}
+
+// DB is a loaded GeoIP file. It is read-only and safe for concurrent use.
+type DB struct {
+	blocks []block // sorted by first
+}
+
+// Open loads the database at path
+func Open(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &DB{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "network") {
+			continue
+		}
+		b, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		db.blocks = append(db.blocks, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.blocks, func(i, j int) bool {
+		return db.blocks[i].first.Less(db.blocks[j].first)
+	})
+	return db, nil
+}
+
+func parseLine(line string) (block, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 5 {
+		return block{}, fmt.Errorf("want 5 fields, got %d", len(fields))
+	}
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return block{}, err
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(fields[3]), 64)
+	if err != nil {
+		return block{}, fmt.Errorf("latitude: %w", err)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(fields[4]), 64)
+	if err != nil {
+		return block{}, fmt.Errorf("longitude: %w", err)
+	}
+	prefix = prefix.Masked()
+	return block{
+		first: prefix.Addr(),
+		last:  lastAddr(prefix),
+		loc: Location{
+			Country:   strings.TrimSpace(fields[1]),
+			City:      strings.TrimSpace(fields[2]),
+			Latitude:  lat,
+			Longitude: lon,
+		},
+	}, nil
+}
+
+// lastAddr is the highest address in prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Lookup returns the location of ip, if the database knows it
+func (db *DB) Lookup(ip string) (Location, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap()
+
+	// The last block starting at or before addr is the only candidate
+	i := sort.Search(len(db.blocks), func(i int) bool {
+		return addr.Less(db.blocks[i].first)
+	}) - 1
+	if i < 0 {
+		return Location{}, false
+	}
+	b := db.blocks[i]
+	if b.first.BitLen() != addr.BitLen() || b.last.Less(addr) {
+		return Location{}, false
+	}
+	return b.loc, true
+}
+
+// Distance is the great-circle distance between a and b in kilometres
+func Distance(a, b Location) float64 {
+	const earthRadius = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
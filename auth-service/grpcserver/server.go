@@ -0,0 +1,290 @@
+package grpcserver
+
+import (
+	"auth-service/model"
+	"auth-service/proto/authpb"
+	"auth-service/service"
+	"auth-service/utils"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements authpb.AuthServiceServer on top of the same
+// service.AuthService the HTTP controllers use
+type Server struct {
+	authpb.UnimplementedAuthServiceServer
+	Service *service.AuthService
+}
+
+// ListenAndServe serves the AuthService gRPC API on addr until it fails.
+// The API signs users in and hands out tokens without any client
+// authentication of its own, so it is only for services on the same host or
+// internal network: without creds (mutual TLS) addr must be a loopback
+// address.
+func ListenAndServe(addr string, svc *service.AuthService, creds credentials.TransportCredentials) error {
+	if creds == nil && !isLoopback(addr) {
+		return fmt.Errorf("refusing to serve gRPC on %s without mutual TLS", addr)
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	var opts []grpc.ServerOption
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s := grpc.NewServer(opts...)
+	authpb.RegisterAuthServiceServer(s, &Server{Service: svc})
+	return s.Serve(lis)
+}
+
+// MutualTLS loads the server's certificate and requires clients to present
+// one signed by the CA in clientCAFile
+func MutualTLS(certFile, keyFile, clientCAFile string) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}), nil
+}
+
+// isLoopback reports whether addr only listens on the local host
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) Register(ctx context.Context, req *authpb.RegisterRequest) (*authpb.AuthResponse, error) {
+	if req.GetEmail() == "" || req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email and password are required")
+	}
+
+	// RegisterRequest has no invitation field, callers pass it as metadata
+	var invitation string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("x-invitation-token"); len(v) > 0 {
+			invitation = v[0]
+		}
+	}
+
+	user, err := s.Service.Register(service.RegisterInput{
+		Email:           req.GetEmail(),
+		Password:        req.GetPassword(),
+		FirstName:       req.GetFirstName(),
+		LastName:        req.GetLastName(),
+		InvitationToken: invitation,
+	}, clientInfo(ctx))
+	if err != nil {
+		if errors.Is(err, service.ErrRegistrationClosed) || errors.Is(err, service.ErrInvalidInvitation) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if _, ok := service.IsPasswordRejected(err); ok {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "registration failed")
+	}
+
+	// An invitation may have fixed the address, so sign in with the user's
+	result, err := s.Service.Login(user.Email, req.GetPassword(), 0, clientInfo(ctx))
+	if err != nil || result.Tokens == nil {
+		return nil, status.Error(codes.Internal, "registration succeeded but login failed")
+	}
+	return authResponse(result.Tokens, user), nil
+}
+
+func (s *Server) Login(ctx context.Context, req *authpb.LoginRequest) (*authpb.AuthResponse, error) {
+	// LoginRequest has no organization field either
+	var orgID uint
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("x-org-id"); len(v) > 0 {
+			id, err := strconv.ParseUint(v[0], 10, 64)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, "invalid x-org-id")
+			}
+			orgID = uint(id)
+		}
+	}
+
+	result, err := s.Service.Login(req.GetEmail(), req.GetPassword(), orgID, clientInfo(ctx))
+	if err != nil {
+		if _, ok := service.IsTooManyAttempts(err); ok {
+			return nil, status.Error(codes.ResourceExhausted, "too many failed attempts, try again later")
+		}
+		if errors.Is(err, service.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	if result.MFAToken != "" {
+		// AuthResponse has no room for a challenge; MFA users sign in over HTTP
+		return nil, status.Error(codes.FailedPrecondition, "multi-factor authentication required, use POST /login/mfa")
+	}
+	return s.withUser(result.Tokens)
+}
+
+// ValidateToken accepts the same credentials as the HTTP API: access tokens
+// of users and OAuth clients, and API keys
+func (s *Server) ValidateToken(ctx context.Context, req *authpb.ValidateTokenRequest) (*authpb.ValidateTokenResponse, error) {
+	claims, err := utils.ValidateCredential(req.GetToken())
+	if err != nil {
+		return &authpb.ValidateTokenResponse{Valid: false}, nil
+	}
+	if claims.UserID == 0 {
+		// Service accounts and OAuth clients have no user profile
+		return &authpb.ValidateTokenResponse{Valid: true, User: &authpb.User{
+			Id:    claims.Subject,
+			Email: claims.Email,
+			Roles: claims.ActiveRoles(time.Now()),
+		}}, nil
+	}
+
+	user, err := s.Service.GetUser(claims.UserID)
+	if err != nil {
+		return &authpb.ValidateTokenResponse{Valid: false}, nil
+	}
+
+	pbUser := toUser(user)
+	// The token's roles are what the caller was granted at issue time
+	pbUser.Roles = claims.ActiveRoles(time.Now())
+	return &authpb.ValidateTokenResponse{Valid: true, User: pbUser}, nil
+}
+
+func (s *Server) RefreshToken(ctx context.Context, req *authpb.RefreshTokenRequest) (*authpb.AuthResponse, error) {
+	pair, err := s.Service.Refresh(req.GetRefreshToken(), clientInfo(ctx))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "token refresh failed")
+	}
+	return s.withUser(pair)
+}
+
+// ChangePassword changes the password of the user whose access token comes
+// as "authorization: Bearer <token>" metadata. user_id, if set, must name
+// that same user.
+func (s *Server) ChangePassword(ctx context.Context, req *authpb.ChangePasswordRequest) (*authpb.ChangePasswordResponse, error) {
+	claims, err := bearerClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Act != nil {
+		return nil, status.Error(codes.PermissionDenied, service.ErrImpersonating.Error())
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+	if id := req.GetUserId(); id != "" && id != strconv.FormatUint(uint64(claims.UserID), 10) {
+		return nil, status.Error(codes.PermissionDenied, "user_id is not the token's user")
+	}
+
+	err = s.Service.ChangePassword(claims.UserID, req.GetCurrentPassword(), req.GetNewPassword(), clientInfo(ctx))
+	if err != nil {
+		if _, ok := service.IsTooManyAttempts(err); ok {
+			return nil, status.Error(codes.ResourceExhausted, "too many failed attempts, try again later")
+		}
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			return &authpb.ChangePasswordResponse{Success: false, Message: "current password is incorrect"}, nil
+		}
+		if _, ok := service.IsPasswordRejected(err); ok {
+			return &authpb.ChangePasswordResponse{Success: false, Message: err.Error()}, nil
+		}
+		return nil, status.Error(codes.Internal, "password change failed")
+	}
+	return &authpb.ChangePasswordResponse{Success: true, Message: "password changed"}, nil
+}
+
+// bearerClaims validates the user access token of the call, sent as
+// "authorization: Bearer <token>" metadata
+func bearerClaims(ctx context.Context) (*utils.Claims, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			token = strings.TrimPrefix(v[0], "Bearer ")
+		}
+	}
+	claims, err := utils.ValidateJWT(token)
+	if err != nil || claims.UserID == 0 {
+		return nil, status.Error(codes.Unauthenticated, "a user access token is required")
+	}
+	return claims, nil
+}
+
+// withUser builds an AuthResponse, loading the token's user for the profile
+func (s *Server) withUser(pair *service.TokenPair) (*authpb.AuthResponse, error) {
+	claims, err := utils.ValidateJWT(pair.AccessToken)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "issued an invalid token")
+	}
+	user, err := s.Service.GetUser(claims.UserID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "user lookup failed")
+	}
+	return authResponse(pair, user), nil
+}
+
+// clientInfo reports the peer address of the call, for login throttling
+func clientInfo(ctx context.Context) service.ClientInfo {
+	var info service.ClientInfo
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			info.IP = host
+		}
+	}
+	return info
+}
+
+func authResponse(pair *service.TokenPair, user *model.User) *authpb.AuthResponse {
+	return &authpb.AuthResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		User:         toUser(user),
+	}
+}
+
+func toUser(u *model.User) *authpb.User {
+	return &authpb.User{
+		Id:        strconv.FormatUint(uint64(u.ID), 10),
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Roles:     u.RoleList(),
+		CreatedAt: u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users. Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New picks a Mailer by name: "file" appends to path, anything else logs
+func New(kind, path string) Mailer {
+	switch kind {
+	case "file":
+		return &FileMailer{Path: path}
+	default:
+		return LogMailer{}
+	}
+}
+
+// LogMailer writes messages to the service log instead of sending them
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer appends messages to a local file, mbox style
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "From auth-service %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.ANSIC), msg.To, msg.Subject, msg.Body)
+	return err
+}
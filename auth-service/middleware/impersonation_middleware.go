@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"auth-service/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DenyImpersonation rejects requests made with an impersonation token, for
+// actions an admin must not take in someone else's name
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, ok := requestClaims(c); ok && claims.Impersonated() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating another user"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// MarkImpersonation calls record after every request that was
+// authenticated with an impersonation token, however it ended. It relies
+// on the authentication middleware storing the claims, so it goes first.
+func MarkImpersonation(record func(*gin.Context, *utils.Claims)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if v, ok := c.Get("user"); ok {
+			if claims, ok := v.(*utils.Claims); ok && claims.Impersonated() {
+				record(c, claims)
+			}
+		}
+	}
+}
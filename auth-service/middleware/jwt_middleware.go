@@ -7,12 +7,18 @@ import (
 	"strings"
 )
 
+// credential returns the API key from X-API-Key, or else the bearer token,
+// which may itself be an API key
+func credential(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
-		claims, err := utils.ValidateJWT(tokenStr)
+		claims, err := utils.ValidateCredential(credential(c))
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"auth-service/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission checks if the token grants at least one of the permissions
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := requestClaims(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Set("user", claims)
+
+		for _, p := range permissions {
+			if claims.HasPermission(p) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied: missing permission"})
+		c.Abort()
+	}
+}
+
+// RequireAllPermissions checks if the token grants every one of the
+// permissions
+func RequireAllPermissions(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := requestClaims(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Set("user", claims)
+
+		for _, p := range permissions {
+			if !claims.HasPermission(p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "access denied: missing permission"})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// requestClaims returns the claims an earlier middleware stored, or
+// validates the bearer token itself
+func requestClaims(c *gin.Context) (*utils.Claims, bool) {
+	if v, ok := c.Get("user"); ok {
+		if claims, ok := v.(*utils.Claims); ok {
+			return claims, true
+		}
+	}
+
+	claims, err := utils.ValidateCredential(credential(c))
+	if err != nil {
+		return nil, false
+	}
+	return claims, true
+}
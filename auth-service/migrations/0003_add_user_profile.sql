@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN first_name TEXT;
+ALTER TABLE users ADD COLUMN last_name TEXT;
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN updated_at;
+ALTER TABLE users DROP COLUMN last_name;
+ALTER TABLE users DROP COLUMN first_name;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_at TIMESTAMPTZ;
+
+CREATE TABLE login_throttles (
+  key TEXT PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ,
+  blocked_until TIMESTAMPTZ
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_throttles;
+ALTER TABLE users DROP COLUMN locked_at;
+ALTER TABLE users DROP COLUMN failed_logins;
@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN mfa_secret TEXT;
+ALTER TABLE users ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN mfa_last_step BIGINT;
+
+CREATE TABLE recovery_codes (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE mfa_challenges (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  token_hash TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_mfa_challenges_token_hash ON mfa_challenges (token_hash);
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users DROP COLUMN mfa_last_step;
+ALTER TABLE users DROP COLUMN mfa_enabled;
+ALTER TABLE users DROP COLUMN mfa_secret;
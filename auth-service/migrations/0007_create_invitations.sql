@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE invitations (
+  id SERIAL PRIMARY KEY,
+  email TEXT NOT NULL,
+  roles TEXT NOT NULL,
+  token_hash TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_by_id INTEGER,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_invitations_token_hash ON invitations (token_hash);
+CREATE INDEX idx_invitations_email ON invitations (email);
+
+-- +goose Down
+DROP TABLE IF EXISTS invitations;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE roles (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  description TEXT,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_roles_name ON roles (name);
+
+CREATE TABLE permissions (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  description TEXT,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_permissions_name ON permissions (name);
+
+CREATE TABLE role_permissions (
+  role_id INTEGER NOT NULL REFERENCES roles (id),
+  permission_id INTEGER NOT NULL REFERENCES permissions (id),
+  PRIMARY KEY (role_id, permission_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
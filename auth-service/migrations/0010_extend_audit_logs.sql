@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE audit_logs
+  ADD COLUMN outcome TEXT,
+  ADD COLUMN actor_id BIGINT,
+  ADD COLUMN actor_email TEXT,
+  ADD COLUMN target_type TEXT,
+  ADD COLUMN target_id TEXT,
+  ADD COLUMN ip TEXT,
+  ADD COLUMN user_agent TEXT,
+  ADD COLUMN details TEXT;
+
+CREATE INDEX idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_audit_logs_created_at;
+DROP INDEX IF EXISTS idx_audit_logs_actor_id;
+DROP INDEX IF EXISTS idx_audit_logs_action;
+
+ALTER TABLE audit_logs
+  DROP COLUMN details,
+  DROP COLUMN user_agent,
+  DROP COLUMN ip,
+  DROP COLUMN target_id,
+  DROP COLUMN target_type,
+  DROP COLUMN actor_email,
+  DROP COLUMN actor_id,
+  DROP COLUMN outcome;
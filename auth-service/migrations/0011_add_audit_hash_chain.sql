@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE audit_logs
+  ADD COLUMN prev_hash TEXT,
+  ADD COLUMN hash TEXT;
+
+-- +goose Down
+ALTER TABLE audit_logs
+  DROP COLUMN hash,
+  DROP COLUMN prev_hash;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE sessions (
+  id TEXT PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  user_agent TEXT,
+  ip TEXT,
+  created_at TIMESTAMPTZ,
+  last_seen_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE service_accounts (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  description TEXT,
+  created_by_id INTEGER,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_service_accounts_name ON service_accounts (name);
+
+CREATE TABLE api_keys (
+  id SERIAL PRIMARY KEY,
+  service_account_id INTEGER NOT NULL,
+  name TEXT,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL,
+  scopes TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_by_id INTEGER,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix);
+CREATE INDEX idx_api_keys_service_account_id ON api_keys (service_account_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS service_accounts;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+  id SERIAL PRIMARY KEY,
+  client_id TEXT NOT NULL,
+  secret_hash TEXT NOT NULL,
+  name TEXT,
+  scopes TEXT NOT NULL,
+  created_by_id INTEGER,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_oauth_clients_client_id ON oauth_clients (client_id);
+
+CREATE TABLE revoked_tokens (
+  jti TEXT PRIMARY KEY,
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_revoked_tokens_revoked_at ON revoked_tokens (revoked_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE sso_logins (
+  id SERIAL PRIMARY KEY,
+  state_hash TEXT NOT NULL,
+  code_verifier TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_sso_logins_state_hash ON sso_logins (state_hash);
+
+CREATE TABLE external_identities (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_external_identities_user_id ON external_identities (user_id);
+CREATE UNIQUE INDEX idx_external_identities_subject ON external_identities (issuer, subject);
+
+-- +goose Down
+DROP TABLE IF EXISTS external_identities;
+DROP TABLE IF EXISTS sso_logins;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE role_grants (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  role TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  status TEXT NOT NULL,
+  duration BIGINT NOT NULL,
+  requested_by_id INTEGER,
+  decided_by_id INTEGER,
+  decided_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_role_grants_user_id ON role_grants (user_id);
+CREATE INDEX idx_role_grants_status ON role_grants (status);
+CREATE INDEX idx_role_grants_expires_at ON role_grants (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS role_grants;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE organizations (
+  id SERIAL PRIMARY KEY,
+  slug TEXT NOT NULL,
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_organizations_slug ON organizations (slug);
+
+CREATE TABLE memberships (
+  id SERIAL PRIMARY KEY,
+  org_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  roles TEXT NOT NULL DEFAULT '[]',
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_memberships_org_id ON memberships (org_id);
+CREATE INDEX idx_memberships_user_id ON memberships (user_id);
+CREATE UNIQUE INDEX idx_memberships_user_org ON memberships (org_id, user_id);
+
+ALTER TABLE sessions ADD COLUMN org_id INTEGER;
+ALTER TABLE mfa_challenges ADD COLUMN org_id INTEGER;
+
+-- +goose Down
+ALTER TABLE mfa_challenges DROP COLUMN IF EXISTS org_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
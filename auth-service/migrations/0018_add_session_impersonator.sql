@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN impersonator_id INTEGER;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN IF EXISTS impersonator_id;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE login_records (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  device_hash TEXT NOT NULL,
+  network TEXT NOT NULL,
+  ip TEXT,
+  country TEXT,
+  city TEXT,
+  latitude DOUBLE PRECISION,
+  longitude DOUBLE PRECISION,
+  created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_login_records_user_id ON login_records (user_id);
+CREATE INDEX idx_login_records_created_at ON login_records (created_at);
+
+CREATE TABLE security_events (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  signals TEXT NOT NULL DEFAULT '[]',
+  score INTEGER NOT NULL,
+  step_up BOOLEAN NOT NULL DEFAULT FALSE,
+  ip TEXT,
+  user_agent TEXT,
+  location TEXT,
+  created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_security_events_user_id ON security_events (user_id);
+CREATE INDEX idx_security_events_created_at ON security_events (created_at);
+
+ALTER TABLE mfa_challenges ADD COLUMN email_code_hash TEXT;
+
+-- +goose Down
+ALTER TABLE mfa_challenges DROP COLUMN IF EXISTS email_code_hash;
+DROP TABLE IF EXISTS security_events;
+DROP TABLE IF EXISTS login_records;
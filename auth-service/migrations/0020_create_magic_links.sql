@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE magic_links (
+  id TEXT PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  nonce_hash TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_magic_links_user_id ON magic_links (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS magic_links;
@@ -0,0 +1,45 @@
+-- +goose Up
+-- 0001 declared users.roles TEXT[], but the service stored JSON arrays as
+-- text, and so did invitations and memberships. Turn them all into real
+-- arrays. users.roles may already be TEXT[] where 0001 ran as written.
+-- Anything but a JSON array, such as an empty string or 'null', holds no roles.
+CREATE FUNCTION pg_temp.roles_from_json(roles TEXT) RETURNS TEXT[] AS $$
+  SELECT COALESCE(array_agg(DISTINCT btrim(r)) FILTER (WHERE btrim(r) <> ''), '{}')
+  FROM jsonb_array_elements_text(
+    CASE WHEN jsonb_typeof(NULLIF(btrim(roles), '')::jsonb) = 'array' THEN btrim(roles)::jsonb
+    ELSE '[]'::jsonb END) AS t(r)
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- +goose StatementBegin
+DO $$
+BEGIN
+  IF (SELECT data_type FROM information_schema.columns
+      WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'roles') <> 'ARRAY' THEN
+    ALTER TABLE users ALTER COLUMN roles TYPE TEXT[] USING pg_temp.roles_from_json(roles);
+  END IF;
+END $$;
+-- +goose StatementEnd
+
+ALTER TABLE invitations ALTER COLUMN roles TYPE TEXT[] USING pg_temp.roles_from_json(roles);
+
+ALTER TABLE memberships ALTER COLUMN roles DROP DEFAULT;
+ALTER TABLE memberships ALTER COLUMN roles TYPE TEXT[] USING pg_temp.roles_from_json(roles);
+ALTER TABLE memberships ALTER COLUMN roles SET DEFAULT '{}';
+
+-- Role lookups ask which rows contain a role
+CREATE INDEX idx_users_roles ON users USING GIN (roles);
+CREATE INDEX idx_memberships_roles ON memberships USING GIN (roles);
+
+DROP FUNCTION pg_temp.roles_from_json(TEXT);
+
+-- +goose Down
+-- Back to the JSON text earlier versions of the service read. users.roles
+-- stays TEXT[], as 0001 declares it.
+DROP INDEX IF EXISTS idx_memberships_roles;
+DROP INDEX IF EXISTS idx_users_roles;
+
+ALTER TABLE memberships ALTER COLUMN roles DROP DEFAULT;
+ALTER TABLE memberships ALTER COLUMN roles TYPE TEXT USING array_to_json(roles)::text;
+ALTER TABLE memberships ALTER COLUMN roles SET DEFAULT '[]';
+
+ALTER TABLE invitations ALTER COLUMN roles TYPE TEXT USING array_to_json(roles)::text;
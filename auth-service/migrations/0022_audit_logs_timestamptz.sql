@@ -0,0 +1,8 @@
+-- +goose Up
+-- The audit chain hashes created_at in UTC. TIMESTAMP has no time zone, so
+-- reading it back depended on the session's TimeZone; store an instant.
+-- Entries were always written in UTC.
+ALTER TABLE audit_logs ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+
+-- +goose Down
+ALTER TABLE audit_logs ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
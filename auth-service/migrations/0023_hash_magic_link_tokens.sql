@@ -0,0 +1,9 @@
+-- +goose Up
+-- Links carry a random token now instead of a signed one naming the row;
+-- rows are found by the token's hash. Links already mailed stop working.
+DELETE FROM magic_links;
+ALTER TABLE magic_links RENAME COLUMN id TO token_hash;
+
+-- +goose Down
+DELETE FROM magic_links;
+ALTER TABLE magic_links RENAME COLUMN token_hash TO id;
@@ -0,0 +1,384 @@
+// Package migrations holds the database schema as versioned SQL files,
+// embedded in the binary, and applies them.
+//
+// Files are named NNNN_description.sql and split into a "-- +goose Up" and
+// a "-- +goose Down" section, the format goose uses, so they can still be
+// run with goose by hand. Each section runs as a whole in one transaction,
+// together with the row recording it in schema_migrations.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// ErrSchemaBehind is returned by Check while migrations are pending
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// lockID keeps two processes from migrating at once
+const lockID = 0x61757468 // "auth"
+
+// autoMigrateMarkers name a table, or a column of one, each migration up to
+// the last one GORM's AutoMigrate also covered added first. The newest
+// marker present tells how far a database AutoMigrate created had come.
+var autoMigrateMarkers = []struct {
+	version       int64
+	table, column string
+}{
+	{1, "users", ""},
+	{2, "refresh_tokens", ""},
+	{3, "users", "first_name"},
+	{4, "password_reset_tokens", ""},
+	{5, "users", "failed_logins"},
+	{6, "users", "mfa_secret"},
+	{7, "invitations", ""},
+	{8, "users", "disabled_at"},
+	{9, "roles", ""},
+	{10, "audit_logs", "outcome"},
+	{11, "audit_logs", "hash"},
+	{12, "sessions", ""},
+	{13, "service_accounts", ""},
+	{14, "oauth_clients", ""},
+	{15, "external_identities", ""},
+	{16, "role_grants", ""},
+	{17, "organizations", ""},
+	{18, "sessions", "impersonator_id"},
+	{19, "login_records", ""},
+	{20, "magic_links", ""},
+}
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State is a migration and when it was applied, nil if it wasn't
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// All returns the embedded migrations, oldest first
+func All() ([]Migration, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var all []Migration
+	seen := map[int64]string{}
+	for _, name := range names {
+		m, err := parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if other, ok := seen[m.Version]; ok {
+			return nil, fmt.Errorf("%s and %s have the same version", other, name)
+		}
+		seen[m.Version] = name
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+func parse(name string) (Migration, error) {
+	base := strings.TrimSuffix(path.Base(name), ".sql")
+	num, _, _ := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || version <= 0 {
+		return Migration{}, errors.New("name must start with a positive version number")
+	}
+	body, err := files.ReadFile(name)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	var up, down strings.Builder
+	var section *strings.Builder
+	for _, line := range strings.SplitAfter(string(body), "\n") {
+		switch strings.TrimSpace(line) {
+		case "-- +goose Up":
+			section = &up
+		case "-- +goose Down":
+			section = &down
+		default:
+			if section != nil {
+				section.WriteString(line)
+			}
+		}
+	}
+	m := Migration{
+		Version: version,
+		Name:    base,
+		Up:      strings.TrimSpace(up.String()),
+		Down:    strings.TrimSpace(down.String()),
+	}
+	if m.Up == "" {
+		return Migration{}, errors.New("no -- +goose Up section")
+	}
+	return m, nil
+}
+
+// Status returns every known migration with whether it was applied, plus
+// applied versions this build doesn't know, which a newer build ran
+func Status(db *sql.DB) ([]State, []int64, error) {
+	all, err := All()
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	states := make([]State, len(all))
+	for i, m := range all {
+		states[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &at
+			delete(applied, m.Version)
+		}
+	}
+	var unknown []int64
+	for v := range applied {
+		unknown = append(unknown, v)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i] < unknown[j] })
+	return states, unknown, nil
+}
+
+// Pending returns the migrations not applied yet, oldest first
+func Pending(db *sql.DB) ([]Migration, error) {
+	states, _, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Check returns ErrSchemaBehind unless every migration has been applied.
+// It never changes the database.
+func Check(db *sql.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := unrecorded(db, pending); err != nil {
+		return err
+	}
+	return fmt.Errorf(`%w: %d migrations pending, starting with %s; run "migrate up"`,
+		ErrSchemaBehind, len(pending), pending[0].Name)
+}
+
+// unrecorded returns ErrSchemaBehind if the tables exist although no
+// migration was ever recorded, as AutoMigrate left databases
+func unrecorded(db *sql.DB, pending []Migration) error {
+	if all, err := All(); err != nil || len(pending) < len(all) {
+		return err
+	}
+	version, err := autoMigrated(db)
+	if err != nil || version == 0 {
+		return err
+	}
+	return fmt.Errorf(`%w: no migrations are recorded but the tables exist; if AutoMigrate `+
+		`created them, run "migrate baseline %d" first`, ErrSchemaBehind, version)
+}
+
+// autoMigrated returns the last migration whose marker exists in the
+// database, 0 if none does
+func autoMigrated(db *sql.DB) (int64, error) {
+	for i := len(autoMigrateMarkers) - 1; i >= 0; i-- {
+		m := autoMigrateMarkers[i]
+		var found bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.columns
+  WHERE table_schema = current_schema() AND table_name = $1 AND ($2 = '' OR column_name = $2))`,
+			m.table, m.column).Scan(&found); err != nil {
+			return 0, err
+		}
+		if found {
+			return m.version, nil
+		}
+	}
+	return 0, nil
+}
+
+// Up applies every pending migration, oldest first, and returns those it
+// applied. It stops at the first one that fails, which is rolled back.
+func Up(db *sql.DB) ([]Migration, error) {
+	var done []Migration
+	err := locked(db, func(conn *sql.Conn) error {
+		pending, err := Pending(db)
+		if err != nil {
+			return err
+		}
+		if err := unrecorded(db, pending); err != nil {
+			return err
+		}
+		for _, m := range pending {
+			if err := apply(conn, m.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				m.Version, m.Name, time.Now()); err != nil {
+				return fmt.Errorf("%s: %w", m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest applied migration and returns it, or nil if
+// there was none
+func Down(db *sql.DB) (*Migration, error) {
+	var reverted *Migration
+	err := locked(db, func(conn *sql.Conn) error {
+		states, unknown, err := Status(db)
+		if err != nil {
+			return err
+		}
+		if len(unknown) > 0 {
+			return fmt.Errorf("version %d was applied by a newer build; revert it with that build", unknown[len(unknown)-1])
+		}
+		for i := len(states) - 1; i >= 0; i-- {
+			m := states[i].Migration
+			if states[i].AppliedAt == nil {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("%s can't be reverted", m.Name)
+			}
+			if err := apply(conn, m.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", m.Version); err != nil {
+				return fmt.Errorf("%s: %w", m.Name, err)
+			}
+			reverted = &m
+			return nil
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Baseline records every migration up to version as applied without
+// running it, for databases whose schema was created some other way: by
+// AutoMigrate, or with goose
+func Baseline(db *sql.DB, version int64) ([]Migration, error) {
+	var done []Migration
+	err := locked(db, func(conn *sql.Conn) error {
+		pending, err := Pending(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range pending {
+			if m.Version > version {
+				break
+			}
+			if _, err := conn.ExecContext(context.Background(),
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				m.Version, m.Name, time.Now()); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// apply runs one migration section and records it in one transaction
+func apply(conn *sql.Conn, script, record string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Without arguments the whole section goes to the server as one
+	// simple query, several statements and all
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs fn holding the migration lock, creating schema_migrations
+// first if needed
+func locked(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockID)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL
+)`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// appliedVersions returns when each applied version was applied; nothing
+// if schema_migrations doesn't exist yet
+func appliedVersions(db *sql.DB) (map[int64]time.Time, error) {
+	var table sql.NullString
+	if err := db.QueryRow("SELECT to_regclass('schema_migrations')::text").Scan(&table); err != nil {
+		return nil, err
+	}
+	applied := map[int64]time.Time{}
+	if !table.Valid {
+		return applied, nil
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
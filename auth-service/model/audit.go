@@ -2,9 +2,26 @@ package model
 
 import "time"
 
+// AuditLog is one security-relevant event. Actor is who did it, target is
+// what it was done to; UserEmail is the account the event concerns, which
+// for self-service actions is the actor.
+//
+// Entries form a hash chain: Hash covers the entry's content and PrevHash,
+// the Hash of the entry before it, so editing or deleting a row breaks every
+// link after it. Rows written before chaining was introduced have no hash.
 type AuditLog struct {
-	ID        uint      `gorm:"primaryKey"`
-	Action    string
-	UserEmail string
-	CreatedAt time.Time
+	ID         uint   `gorm:"primaryKey"`
+	Action     string `gorm:"index"`
+	Outcome    string
+	ActorID    *uint `gorm:"index"`
+	ActorEmail string
+	TargetType string
+	TargetID   string
+	UserEmail  string
+	IP         string
+	UserAgent  string
+	Details    string    // JSON object
+	CreatedAt  time.Time `gorm:"index"`
+	PrevHash   string
+	Hash       string
 }
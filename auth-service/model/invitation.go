@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Invitation lets one person register with a fixed email and set of roles.
+// Only the SHA-256 hash of the invitation token is stored.
+type Invitation struct {
+	ID          uint      `gorm:"primaryKey"`
+	Email       string    `gorm:"not null;index"`
+	Roles       TextArray `gorm:"not null"`
+	TokenHash   string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	UsedAt      *time.Time
+	RevokedAt   *time.Time
+	CreatedByID uint
+	CreatedAt   time.Time
+}
+
+// RoleList returns a copy of Roles
+func (i *Invitation) RoleList() []string {
+	return append([]string(nil), i.Roles...)
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key, either
+// "email:<address>" or "ip:<address>", and how long that key is blocked for
+type LoginThrottle struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	BlockedUntil  *time.Time
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// MagicLink is a single-use passwordless login link mailed to a user. Only
+// the SHA-256 hash of the random token in the link is stored; NonceHash
+// binds it to the browser that asked for it.
+type MagicLink struct {
+	TokenHash string    `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	NonceHash string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// RecoveryCode is a single-use backup code for a user who lost their
+// authenticator. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFAChallenge is handed out by a password login when the account has MFA
+// enabled, or the login looked risky, and is exchanged for real tokens
+// together with a second factor
+type MFAChallenge struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	OrgID     *uint  // organization the login asked for
+	// EmailCodeHash is set on step-up challenges of users without MFA; the
+	// code was emailed to them instead of coming from an authenticator
+	EmailCodeHash string
+	Attempts      int       `gorm:"not null;default:0"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OAuthClient is a machine client that obtains access tokens with the OAuth2
+// client_credentials grant. Only the SHA-256 hash of its secret is stored.
+type OAuthClient struct {
+	ID          uint   `gorm:"primaryKey"`
+	ClientID    string `gorm:"uniqueIndex;not null"`
+	SecretHash  string `gorm:"not null"`
+	Name        string
+	Scopes      string `gorm:"not null"` // JSON array of permission names
+	CreatedByID uint
+	CreatedAt   time.Time
+}
+
+// TableName keeps gorm from naming the table o_auth_clients
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// ScopeList decodes the JSON-encoded Scopes column
+func (c *OAuthClient) ScopeList() []string {
+	var scopes []string
+	_ = json.Unmarshal([]byte(c.Scopes), &scopes)
+	return scopes
+}
+
+// RevokedToken denies a single access token that belongs to no session,
+// by its jti, until it expires
+type RevokedToken struct {
+	JTI       string `gorm:"column:jti;primaryKey"`
+	ExpiresAt time.Time
+	RevokedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Organization is a tenant: a client business unit whose data no other
+// organization may see
+type Organization struct {
+	ID        uint   `gorm:"primaryKey"`
+	Slug      string `gorm:"uniqueIndex;not null"`
+	Name      string `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Membership puts a user in an organization with the roles they hold there.
+// Tokens issued for the organization carry these roles instead of
+// User.Roles.
+type Membership struct {
+	ID        uint      `gorm:"primaryKey"`
+	OrgID     uint      `gorm:"not null;index;uniqueIndex:idx_memberships_user_org"`
+	UserID    uint      `gorm:"not null;index;uniqueIndex:idx_memberships_user_org"`
+	Roles     TextArray `gorm:"not null;default:'{}'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RoleList returns a copy of Roles
+func (m *Membership) RoleList() []string {
+	return append([]string(nil), m.Roles...)
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// PasswordResetToken is a single-use token mailed to a user who forgot their
+// password. Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Role is a named bundle of permissions that users are assigned by name
+type Role struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	Permissions []Permission `gorm:"many2many:role_permissions;"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Permission is a single capability such as "employees:write". The special
+// permission "*" grants everything.
+type Permission struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	CreatedAt   time.Time
+}
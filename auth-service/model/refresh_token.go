@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// RefreshToken is an opaque, single-use refresh token. Only the SHA-256 hash
+// of the token is stored. Every token issued by rotating another one shares
+// its FamilyID, so a whole login lineage can be revoked at once.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	FamilyID  string    `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Statuses of a RoleGrant
+const (
+	GrantPending = "pending"
+	GrantActive  = "active"
+	GrantDenied  = "denied"
+	GrantExpired = "expired"
+	GrantRevoked = "revoked"
+)
+
+// RoleGrant gives a user a role for a limited time on top of User.Roles.
+// A grant a user asks for starts pending and runs for Duration from the
+// moment another Admin approves it; Admins can also grant directly.
+type RoleGrant struct {
+	ID            uint   `gorm:"primaryKey"`
+	UserID        uint   `gorm:"not null;index"`
+	Role          string `gorm:"not null"`
+	Reason        string `gorm:"not null"`
+	Status        string `gorm:"not null;index"`
+	Duration      int64  `gorm:"not null"` // seconds
+	RequestedByID uint
+	DecidedByID   *uint
+	DecidedAt     *time.Time
+	ExpiresAt     *time.Time `gorm:"index"`
+	RevokedAt     *time.Time
+	CreatedAt     time.Time
+}
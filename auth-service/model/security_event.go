@@ -0,0 +1,42 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LoginRecord remembers where and on what device a user signed in, as the
+// baseline the next login is compared to
+type LoginRecord struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	DeviceHash string `gorm:"not null"` // SHA-256 of the device fingerprint
+	Network    string `gorm:"not null"` // the /24 (IPv4) or /48 (IPv6) of IP
+	IP         string
+	Country    string
+	City       string
+	Latitude   *float64 // nil when the address isn't in the GeoIP file
+	Longitude  *float64
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+// SecurityEvent is a login the risk evaluator flagged
+type SecurityEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	Kind      string `gorm:"not null"`
+	Signals   string `gorm:"not null;default:'[]'"` // JSON array, e.g. ["new_device"]
+	Score     int    `gorm:"not null"`
+	StepUp    bool   `gorm:"not null;default:false"` // a second factor was demanded
+	IP        string
+	UserAgent string
+	Location  string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// SignalList decodes the JSON-encoded Signals column
+func (e *SecurityEvent) SignalList() []string {
+	var signals []string
+	_ = json.Unmarshal([]byte(e.Signals), &signals)
+	return signals
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ServiceAccount is a non-human identity, such as an import script or another
+// service. It has no password and authenticates with API keys.
+type ServiceAccount struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	CreatedByID uint
+	CreatedAt   time.Time
+}
+
+// APIKey lets a service account call the API with a fixed set of
+// permissions. Keys look like "<Prefix>.<secret>"; the prefix identifies the
+// key and is safe to show, only the SHA-256 hash of the whole key is stored.
+type APIKey struct {
+	ID               uint `gorm:"primaryKey"`
+	ServiceAccountID uint `gorm:"not null;index"`
+	Name             string
+	Prefix           string    `gorm:"uniqueIndex;not null"`
+	KeyHash          string    `gorm:"not null"`
+	Scopes           string    `gorm:"not null"` // JSON array of permission names
+	ExpiresAt        time.Time `gorm:"not null"`
+	LastUsedAt       *time.Time
+	RevokedAt        *time.Time
+	CreatedByID      uint
+	CreatedAt        time.Time
+}
+
+// ScopeList decodes the JSON-encoded Scopes column
+func (k *APIKey) ScopeList() []string {
+	var scopes []string
+	_ = json.Unmarshal([]byte(k.Scopes), &scopes)
+	return scopes
+}
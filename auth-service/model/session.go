@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Session is one signed-in device. Its ID is the FamilyID of the refresh
+// tokens issued to it, and the jti of every access token issued from them,
+// so revoking a session invalidates both.
+type Session struct {
+	ID     string `gorm:"primaryKey"`
+	UserID uint   `gorm:"not null;index"`
+	// OrgID is the organization the session acts in, nil outside any
+	OrgID *uint
+	// ImpersonatorID is the admin acting as the user in this session, nil
+	// for sessions the user signed in to themselves
+	ImpersonatorID *uint
+	UserAgent      string
+	IP             string
+	CreatedAt      time.Time
+	LastSeenAt     time.Time
+	ExpiresAt      time.Time
+	RevokedAt      *time.Time
+}
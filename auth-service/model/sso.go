@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// SSOLogin is an authorization request in flight to the identity provider,
+// found again by its state when the browser comes back. Only the SHA-256
+// hash of the state is stored.
+type SSOLogin struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;not null"`
+	CodeVerifier string    `gorm:"not null"` // PKCE verifier, never leaves the server
+	Nonce        string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	UsedAt       *time.Time
+	CreatedAt    time.Time
+}
+
+// ExternalIdentity links a user to an account at an external identity
+// provider, so renaming the email there doesn't create a second user here
+type ExternalIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	Issuer    string `gorm:"not null;uniqueIndex:idx_external_identities_subject"`
+	Subject   string `gorm:"not null;uniqueIndex:idx_external_identities_subject"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TextArray is a Postgres TEXT[] column
+type TextArray []string
+
+// textArrays encodes and decodes TEXT[] in Postgres array syntax, quoting
+// and escaping like the server does
+var textArrays = pgtype.NewMap()
+
+// GormDataType tells GORM the column type
+func (TextArray) GormDataType() string {
+	return "text[]"
+}
+
+// Value encodes a in Postgres array syntax. A nil array is stored empty,
+// not NULL.
+func (a TextArray) Value() (driver.Value, error) {
+	if a == nil {
+		a = TextArray{}
+	}
+	buf, err := textArrays.Encode(pgtype.TextArrayOID, pgtype.TextFormatCode, []string(a), nil)
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+// Scan decodes a Postgres text array. NULL elements are dropped, and so is
+// the nesting of multi-dimensional arrays.
+func (a *TextArray) Scan(src interface{}) error {
+	if src == nil {
+		*a = TextArray{}
+		return nil
+	}
+	var elems pgtype.FlatArray[pgtype.Text]
+	if err := textArrays.SQLScanner(&elems).Scan(src); err != nil {
+		return fmt.Errorf("cannot scan %T into TextArray: %w", src, err)
+	}
+
+	out := TextArray{}
+	for _, e := range elems {
+		if e.Valid {
+			out = append(out, e.String)
+		}
+	}
+	*a = out
+	return nil
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextArrayScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want TextArray
+	}{
+		{"null column", nil, TextArray{}},
+		{"empty", "{}", TextArray{}},
+		{"bare", "{Admin,User}", TextArray{"Admin", "User"}},
+		{"bytes", []byte("{Admin}"), TextArray{"Admin"}},
+		{"quoted", `{"HR Manager","a,b"}`, TextArray{"HR Manager", "a,b"}},
+		{"escaped", `{"say \"hi\"","back\\slash"}`, TextArray{`say "hi"`, `back\slash`}},
+		{"empty element", `{""}`, TextArray{""}},
+		{"null element", `{a,NULL,b}`, TextArray{"a", "b"}},
+		{"quoted null", `{"NULL"}`, TextArray{"NULL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got TextArray
+			if err := got.Scan(tt.src); err != nil {
+				t.Fatalf("Scan(%q): %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextArrayScanInvalid(t *testing.T) {
+	for _, src := range []interface{}{`{"open`, "no braces", 42} {
+		var a TextArray
+		if err := a.Scan(src); err == nil {
+			t.Errorf("Scan(%v) = %q, want an error", src, a)
+		}
+	}
+}
+
+func TestTextArrayRoundTrip(t *testing.T) {
+	for _, in := range []TextArray{
+		nil,
+		{},
+		{"Admin"},
+		{"", "NULL", " padded ", `q"uote`, `back\slash`, "{braces}", "a,b"},
+	} {
+		v, err := in.Value()
+		if err != nil {
+			t.Fatalf("Value(%q): %v", in, err)
+		}
+		var out TextArray
+		if err := out.Scan(v); err != nil {
+			t.Fatalf("Scan(%q): %v", v, err)
+		}
+		want := in
+		if want == nil {
+			want = TextArray{}
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("round trip of %q gave %q via %q", in, out, v)
+		}
+	}
+}
@@ -3,9 +3,24 @@ package model
 import "time"
 
 type User struct {
-    ID             uint      `gorm:"primaryKey"`
-    Email          string    `gorm:"unique;not null"`
-    HashedPassword string    `gorm:"not null"`
-    Roles          string    `gorm:"not null"` // "Admin,HR"
-    CreatedAt      time.Time
+	ID             uint   `gorm:"primaryKey"`
+	Email          string `gorm:"unique;not null"`
+	HashedPassword string `gorm:"not null"`
+	FirstName      string
+	LastName       string
+	Roles          TextArray `gorm:"not null"` // e.g. {Admin,HR}
+	FailedLogins   int       `gorm:"not null;default:0"`
+	LockedAt       *time.Time
+	MFASecret      string // base32 TOTP secret, set at enrollment
+	MFAEnabled     bool   `gorm:"not null;default:false"`
+	MFALastStep    int64  // last accepted TOTP time step, to stop code replay
+	DisabledAt     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// RoleList returns a copy of Roles, the roles the user holds outside any
+// organization
+func (u *User) RoleList() []string {
+	return append([]string(nil), u.Roles...)
 }
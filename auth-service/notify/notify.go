@@ -0,0 +1,58 @@
+// Package notify tells users about things that happened to their account,
+// such as a sign-in that looked suspicious.
+package notify
+
+import (
+	"auth-service/mailer"
+	"log"
+)
+
+// Notice is one message for one user
+type Notice struct {
+	Kind    string // e.g. "suspicious_login"
+	UserID  uint
+	Email   string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers notices. Implementations must be safe for concurrent
+// use.
+type Notifier interface {
+	Notify(n Notice) error
+}
+
+// New picks a Notifier by name: "mail" sends through m, "none" drops
+// notices and anything else logs them
+func New(kind string, m mailer.Mailer) Notifier {
+	switch kind {
+	case "mail":
+		return MailNotifier{Mailer: m}
+	case "none":
+		return Nop{}
+	default:
+		return LogNotifier{}
+	}
+}
+
+// MailNotifier emails notices to the user
+type MailNotifier struct {
+	Mailer mailer.Mailer
+}
+
+func (n MailNotifier) Notify(notice Notice) error {
+	return n.Mailer.Send(mailer.Message{To: notice.Email, Subject: notice.Subject, Body: notice.Body})
+}
+
+// LogNotifier writes notices to the service log
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(n Notice) error {
+	log.Printf("notice kind=%s user=%d to=%s subject=%q\n%s", n.Kind, n.UserID, n.Email, n.Subject, n.Body)
+	return nil
+}
+
+// Nop drops every notice
+type Nop struct{}
+
+func (Nop) Notify(Notice) error { return nil }
@@ -0,0 +1,306 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and ID token validation.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client talks to one OIDC issuer on behalf of one registered client. The
+// issuer is discovered on first use, so it may start after this service.
+type Client struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients relying on PKCE alone
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+
+	HTTP *http.Client
+
+	mu       sync.Mutex
+	provider *provider
+}
+
+// provider is the part of the discovery document we use, plus its keys
+type provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// IDToken is a validated ID token
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Claims        jwt.MapClaims
+}
+
+// Strings returns a claim holding a list of strings, such as groups. A
+// single string is returned as a one-element list.
+func (t *IDToken) Strings(claim string) []string {
+	switch v := t.Claims[claim].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// NewPKCE returns a code verifier and its S256 challenge (RFC 7636)
+func NewPKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL is where to send the browser to sign in
+func (c *Client) AuthCodeURL(state, nonce, challenge string) (string, error) {
+	p, err := c.discover()
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(c.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the validated ID token.
+// nonce must be the one sent with the authorization request.
+func (c *Client) Exchange(code, verifier, nonce string) (*IDToken, error) {
+	p, err := c.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"client_id":     {c.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := c.do(req, &body); err != nil && body.Error == "" {
+		return nil, err
+	}
+	if body.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("token endpoint returned no id_token")
+	}
+	return c.verify(p, body.IDToken, nonce)
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce
+func (c *Client) verify(p *provider, raw, nonce string) (*IDToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.key(p, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(c.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	// With several audiences the token must name us as the authorized party
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != c.ClientID {
+			return nil, errors.New("invalid id_token: azp mismatch")
+		}
+	}
+
+	t := &IDToken{Claims: claims}
+	t.Subject, _ = claims["sub"].(string)
+	t.Email, _ = claims["email"].(string)
+	t.GivenName, _ = claims["given_name"].(string)
+	t.FamilyName, _ = claims["family_name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		t.EmailVerified = v
+	case string:
+		t.EmailVerified = v == "true"
+	}
+	if t.Subject == "" {
+		return nil, errors.New("invalid id_token: no subject")
+	}
+	return t, nil
+}
+
+// discover fetches the issuer's discovery document once
+func (c *Client) discover() (*provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var p provider
+	if err := c.do(req, &p); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if p.Issuer != c.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match configured %q", p.Issuer, c.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: document is missing endpoints")
+	}
+	c.provider = &p
+	return c.provider, nil
+}
+
+// key returns the provider's verification key kid, refetching the JWKS when
+// the kid is unknown (at most once a minute, to survive key rotation cheaply)
+func (c *Client) key(p *provider, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < time.Minute && p.keys != nil {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+
+	p.keys = map[string]interface{}{}
+	p.keysFetched = time.Now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = pub
+		}
+	}
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	// A lone key without kid is fine for tokens without one
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (c *Client) scopes() []string {
+	scopes := []string{"openid"}
+	for _, s := range c.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// do sends req and decodes a JSON response into out. Error responses are
+// decoded too, so callers can read OAuth error fields.
+func (c *Client) do(req *http.Request, out interface{}) error {
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: unexpected response (%s)", req.URL, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", req.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package passhash hashes passwords into self-describing strings. Argon2id
+// hashes use the PHC string format, bcrypt hashes their own modular crypt
+// format, so a stored hash says which hasher and parameters made it and old
+// hashes keep working after the parameters change.
+package passhash
+
+import (
+	"errors"
+)
+
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Hasher is one password hashing scheme
+type Hasher interface {
+	// Hash returns the encoded hash of password with a fresh salt
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded
+	Verify(encoded, password string) (bool, error)
+	// Handles reports whether encoded is in this hasher's format
+	Handles(encoded string) bool
+	// NeedsRehash reports whether encoded was made with other parameters
+	// than the hasher's current ones
+	NeedsRehash(encoded string) bool
+}
+
+// Policy hashes new passwords with Current and still verifies hashes made by
+// any of Legacy
+type Policy struct {
+	Current Hasher
+	Legacy  []Hasher
+}
+
+// Hash hashes password with the current hasher
+func (p *Policy) Hash(password string) (string, error) {
+	return p.Current.Hash(password)
+}
+
+// Verify checks password against encoded with whichever hasher made it.
+// rehash is set when the password matched but encoded should be replaced
+// with a fresh Hash, because it uses a legacy hasher or old parameters.
+func (p *Policy) Verify(encoded, password string) (ok, rehash bool, err error) {
+	h := p.hasherFor(encoded)
+	if h == nil {
+		return false, false, ErrUnknownFormat
+	}
+	if ok, err = h.Verify(encoded, password); err != nil || !ok {
+		return false, false, err
+	}
+	return true, h != p.Current || h.NeedsRehash(encoded), nil
+}
+
+func (p *Policy) hasherFor(encoded string) Hasher {
+	if p.Current.Handles(encoded) {
+		return p.Current
+	}
+	for _, h := range p.Legacy {
+		if h.Handles(encoded) {
+			return h
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2id keeps the tests fast; the format doesn't depend on the cost
+var testArgon2id = Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	encoded, err := testArgon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("unexpected encoding %q", encoded)
+	}
+	if !testArgon2id.Handles(encoded) {
+		t.Error("Handles rejected its own hash")
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if params != testArgon2id {
+		t.Errorf("decoded parameters %+v, want %+v", params, testArgon2id)
+	}
+	if len(salt) != 16 || len(key) != 32 {
+		t.Errorf("salt %d and key %d bytes, want 16 and 32", len(salt), len(key))
+	}
+	if got := testArgon2id.encode(salt, key); got != encoded {
+		t.Errorf("re-encoded as %q, want %q", got, encoded)
+	}
+
+	if ok, err := testArgon2id.Verify(encoded, "correct horse"); err != nil || !ok {
+		t.Errorf("Verify(right password) = %v, %v", ok, err)
+	}
+	if ok, err := testArgon2id.Verify(encoded, "correct horsf"); err != nil || ok {
+		t.Errorf("Verify(wrong password) = %v, %v", ok, err)
+	}
+
+	again, err := testArgon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == encoded {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestArgon2idVerifiesWithStoredParameters(t *testing.T) {
+	old := Argon2id{Memory: 2048, Time: 2, Threads: 2, SaltLen: 8, KeyLen: 16}
+	encoded, err := old.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A hasher with other parameters still checks hashes made with old ones
+	if ok, err := testArgon2id.Verify(encoded, "hunter2"); err != nil || !ok {
+		t.Errorf("Verify = %v, %v", ok, err)
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	encoded, err := testArgon2id.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testArgon2id.NeedsRehash(encoded) {
+		t.Error("hash with current parameters needs rehash")
+	}
+
+	for name, other := range map[string]Argon2id{
+		"memory":  {Memory: 2048, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+		"time":    {Memory: 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32},
+		"threads": {Memory: 1024, Time: 1, Threads: 2, SaltLen: 16, KeyLen: 32},
+		"salt":    {Memory: 1024, Time: 1, Threads: 1, SaltLen: 32, KeyLen: 32},
+		"key":     {Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 64},
+	} {
+		if !other.NeedsRehash(encoded) {
+			t.Errorf("changed %s: no rehash", name)
+		}
+	}
+	if !testArgon2id.NeedsRehash("$argon2id$garbage") {
+		t.Error("malformed hash needs no rehash")
+	}
+}
+
+func TestDecodeArgon2idRejectsMalformed(t *testing.T) {
+	const salt, key = "c29tZXNhbHQ", "CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+	for name, encoded := range map[string]string{
+		"other algorithm": "$argon2i$v=19$m=1024,t=1,p=1$" + salt + "$" + key,
+		"missing part":    "$argon2id$v=19$m=1024,t=1,p=1$" + salt,
+		"old version":     "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key,
+		"bad parameters":  "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key,
+		"zero time":       "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key,
+		"zero threads":    "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key,
+		"bad salt":        "$argon2id$v=19$m=1024,t=1,p=1$!!!$" + key,
+		"bad hash":        "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$!!!",
+		"empty hash":      "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$",
+	} {
+		if _, _, _, err := decodeArgon2id(encoded); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("%s: err = %v, want ErrUnknownFormat", name, err)
+		}
+	}
+}
+
+func TestPolicyVerify(t *testing.T) {
+	p := &Policy{Current: testArgon2id, Legacy: []Hasher{Bcrypt{Cost: bcrypt.MinCost}}}
+
+	current, err := p.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outdated, err := Argon2id{Memory: 2048, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}.Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		encoded    string
+		password   string
+		ok, rehash bool
+	}{
+		{"current", current, "pw", true, false},
+		{"current, wrong password", current, "nope", false, false},
+		{"legacy bcrypt", legacy, "pw", true, true},
+		{"legacy bcrypt, wrong password", legacy, "nope", false, false},
+		{"old parameters", outdated, "pw", true, true},
+	}
+	for _, tt := range tests {
+		ok, rehash, err := p.Verify(tt.encoded, tt.password)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if ok != tt.ok || rehash != tt.rehash {
+			t.Errorf("%s: ok=%v rehash=%v, want ok=%v rehash=%v", tt.name, ok, rehash, tt.ok, tt.rehash)
+		}
+	}
+
+	if _, _, err := p.Verify("plaintext", "plaintext"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format: err = %v, want ErrUnknownFormat", err)
+	}
+}
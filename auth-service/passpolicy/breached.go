@@ -0,0 +1,152 @@
+package passpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// prefixLen is the length of the hash prefix ranges are keyed by, as in the
+// Pwned Passwords range API
+const prefixLen = 5
+
+// BreachList is a local file of breached password hashes: one
+// "SHA1:COUNT" line per password, sorted by hash, as the Pwned Passwords
+// downloader writes it. Lookups work like the k-anonymity range API: the
+// range of lines sharing the first five hex digits of the hash is found by
+// binary search and only its suffixes are compared, so the file is never
+// loaded into memory.
+type BreachList struct {
+	file *os.File
+	size int64
+}
+
+// OpenBreachList opens the file at path
+func OpenBreachList(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &BreachList{file: f, size: info.Size()}, nil
+}
+
+// Close closes the file
+func (b *BreachList) Close() error {
+	return b.file.Close()
+}
+
+// Count returns how often password was seen in breaches, 0 if never
+func (b *BreachList) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	start, err := b.rangeStart(prefix)
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(b.file, start, b.size-start))
+	for {
+		line, err := readLine(r)
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		key := hashOf(line)
+		if !strings.HasPrefix(key, prefix) {
+			return 0, nil
+		}
+		if key[prefixLen:] == suffix {
+			_, count, _ := strings.Cut(line, ":")
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil {
+				// A list of bare hashes says nothing about how common it is
+				n = 1
+			}
+			return n, nil
+		}
+	}
+}
+
+// rangeStart finds the offset of the first line whose hash is not below
+// prefix
+func (b *BreachList) rangeStart(prefix string) (int64, error) {
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := b.lineFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		key := hashOf(line)
+		if len(key) > prefixLen {
+			key = key[:prefixLen]
+		}
+		if start < b.size && key < prefix {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	start, _, err := b.lineFrom(lo)
+	return start, err
+}
+
+// lineFrom returns the first line starting at or after off, and where it
+// starts; at the end of the file start is the file size
+func (b *BreachList) lineFrom(off int64) (int64, string, error) {
+	start := off
+	if off > 0 {
+		// off might be mid-line: skip to the byte after the previous newline
+		start = off - 1
+	}
+	if start >= b.size {
+		return b.size, "", nil
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(b.file, start, b.size-start), 512)
+	if off > 0 {
+		skipped, err := r.ReadString('\n')
+		if err == io.EOF {
+			return b.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := readLine(r)
+	if err == io.EOF {
+		return b.size, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("breach list: %w", err)
+	}
+	return start, line, nil
+}
+
+// readLine reads one line without its line ending
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// hashOf is the uppercased hash a line starts with
+func hashOf(line string) string {
+	hash, _, _ := strings.Cut(line, ":")
+	return strings.ToUpper(strings.TrimSpace(hash))
+}
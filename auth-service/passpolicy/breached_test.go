@@ -0,0 +1,140 @@
+package passpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeBreachList writes lines sorted by hash, as the Pwned Passwords
+// downloader does, and opens the file
+func writeBreachList(t *testing.T, lines []string, eol string) *BreachList {
+	t.Helper()
+	sort.Slice(lines, func(i, j int) bool { return hashOf(lines[i]) < hashOf(lines[j]) })
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, eol)+eol), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := OpenBreachList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { list.Close() })
+	return list
+}
+
+func TestBreachListCount(t *testing.T) {
+	counts := map[string]int{}
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		pw := fmt.Sprintf("breached-%d", i)
+		counts[pw] = i + 1
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(pw), i+1))
+	}
+
+	for _, eol := range []string{"\n", "\r\n"} {
+		list := writeBreachList(t, append([]string(nil), lines...), eol)
+		for pw, want := range counts {
+			got, err := list.Count(pw)
+			if err != nil {
+				t.Fatalf("Count(%q): %v", pw, err)
+			}
+			if got != want {
+				t.Errorf("eol %q: Count(%q) = %d, want %d", eol, pw, got, want)
+			}
+		}
+		for i := 0; i < 200; i++ {
+			pw := fmt.Sprintf("never-breached-%d", i)
+			if got, err := list.Count(pw); err != nil || got != 0 {
+				t.Errorf("eol %q: Count(%q) = %d, %v, want 0", eol, pw, got, err)
+			}
+		}
+	}
+}
+
+func TestBreachListSharedPrefix(t *testing.T) {
+	target := sha1Hex("hunter2")
+	prefix := target[:prefixLen]
+	// Neighbours share the range prefix but differ in the suffix
+	lines := []string{
+		prefix + strings.Repeat("0", 35) + ":7",
+		target + ":42",
+		prefix + strings.Repeat("F", 35) + ":9",
+		"00000" + strings.Repeat("1", 35) + ":1",
+		"FFFFF" + strings.Repeat("1", 35) + ":1",
+	}
+	list := writeBreachList(t, lines, "\n")
+	if got, err := list.Count("hunter2"); err != nil || got != 42 {
+		t.Errorf("Count = %d, %v, want 42", got, err)
+	}
+}
+
+func TestBreachListFormats(t *testing.T) {
+	lines := []string{
+		strings.ToLower(sha1Hex("lowercase")) + ":3",
+		sha1Hex("bare"),
+		sha1Hex("padded") + ": 5 ",
+	}
+	list := writeBreachList(t, lines, "\n")
+	for pw, want := range map[string]int{"lowercase": 3, "bare": 1, "padded": 5} {
+		if got, err := list.Count(pw); err != nil || got != want {
+			t.Errorf("Count(%q) = %d, %v, want %d", pw, got, err, want)
+		}
+	}
+}
+
+func TestBreachListEdges(t *testing.T) {
+	first, last := sha1Hex("first"), sha1Hex("last")
+	list := writeBreachList(t, []string{first + ":1", last + ":2"}, "\n")
+	if got, _ := list.Count("first"); got != 1 {
+		t.Errorf("first line: Count = %d, want 1", got)
+	}
+	if got, _ := list.Count("last"); got != 2 {
+		t.Errorf("last line: Count = %d, want 2", got)
+	}
+
+	// No trailing newline
+	path := filepath.Join(t.TempDir(), "short.txt")
+	if err := os.WriteFile(path, []byte(sha1Hex("only")+":8"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	short, err := OpenBreachList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer short.Close()
+	if got, err := short.Count("only"); err != nil || got != 8 {
+		t.Errorf("without trailing newline: Count = %d, %v, want 8", got, err)
+	}
+
+	empty := writeBreachList(t, nil, "")
+	if got, err := empty.Count("anything"); err != nil || got != 0 {
+		t.Errorf("empty list: Count = %d, %v", got, err)
+	}
+}
+
+func TestPolicyCheckBreached(t *testing.T) {
+	list := writeBreachList(t, []string{
+		sha1Hex("g7Jk2pQz9wXr") + ":1",
+		sha1Hex("Xq4mP9vL2kRt") + ":250",
+	}, "\n")
+	policy := Policy{Breached: list, MinBreachCount: 10}
+
+	if err := policy.Check("g7Jk2pQz9wXr", Context{}); err != nil {
+		t.Errorf("seen once, below MinBreachCount: %v", err)
+	}
+	err := policy.Check("Xq4mP9vL2kRt", Context{})
+	if got := violatedRules(t, err); len(got) != 1 || got[0] != RuleBreached {
+		t.Errorf("seen 250 times: violated %v, want [%s]", got, RuleBreached)
+	}
+}
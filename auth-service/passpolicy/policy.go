@@ -0,0 +1,140 @@
+// Package passpolicy decides whether a new password is acceptable: long
+// enough, not built from the user's own name or email, hard enough to guess
+// and not known from a data breach.
+package passpolicy
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rules a password can violate
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleContext   = "context"
+	RuleStrength  = "strength"
+	RuleBreached  = "breached"
+)
+
+// Violation is one rule a password failed
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lists every rule a password failed
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return "password rejected: " + strings.Join(msgs, "; ")
+}
+
+// Context is what is known about the user choosing the password
+type Context struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// words are the parts of the context a password must not contain
+func (c Context) words() []string {
+	local, domain, _ := strings.Cut(strings.ToLower(c.Email), "@")
+	words := []string{strings.ToLower(c.FirstName), strings.ToLower(c.LastName)}
+	// jane.doe@example.com yields "jane.doe", "jane", "doe" and "example"
+	words = append(words, local)
+	words = append(words, strings.FieldsFunc(local, func(r rune) bool { return strings.ContainsRune("._-+", r) })...)
+	if name, _, ok := strings.Cut(domain, "."); ok {
+		words = append(words, name)
+	}
+
+	out := words[:0]
+	for _, w := range words {
+		if utf8.RuneCountInString(w) >= 3 {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// Policy is a set of password rules. Zero values turn a rule off.
+type Policy struct {
+	MinLength int // in characters
+	MaxLength int
+	// NoContext rejects passwords containing the user's name or email
+	NoContext bool
+	// MinStrength is the lowest acceptable Strength score, 0 to 4
+	MinStrength int
+	// Breached is checked when set; passwords seen at least MinBreachCount
+	// times are rejected
+	Breached       *BreachList
+	MinBreachCount int
+}
+
+// Default follows NIST SP 800-63B with a little more length
+var Default = Policy{MinLength: 12, MaxLength: 128, NoContext: true, MinStrength: 3}
+
+// Check returns an *Error listing every rule password violates, or nil
+func (p Policy) Check(password string, ctx Context) error {
+	var violations []Violation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add(RuleMinLength, "must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, "must be at most %d characters long", p.MaxLength)
+	}
+
+	words := ctx.words()
+	if p.NoContext && containsAny(password, words) {
+		add(RuleContext, "must not contain your name or email address")
+	}
+
+	// An empty or overlong password already failed; don't pile on
+	tooLong := p.MaxLength > 0 && length > p.MaxLength
+	if p.MinStrength > 0 && length > 0 && !tooLong {
+		if score, _ := Strength(password, words); score < p.MinStrength {
+			add(RuleStrength, "is too easy to guess (strength %d of 4, %d needed)", score, p.MinStrength)
+		}
+	}
+
+	if p.Breached != nil && length > 0 {
+		count, err := p.Breached.Count(password)
+		if err != nil {
+			// Don't lock everyone out of changing passwords over a bad file
+			log.Printf("breached password lookup failed: %v", err)
+		} else if count > 0 && count >= p.MinBreachCount {
+			add(RuleBreached, "has appeared in a data breach and must not be used")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// containsAny reports whether password contains one of words, also after
+// undoing common character substitutions such as 4 for a
+func containsAny(password string, words []string) bool {
+	lower := strings.ToLower(password)
+	plain := unleet(lower)
+	for _, w := range words {
+		if strings.Contains(lower, w) || strings.Contains(plain, w) {
+			return true
+		}
+	}
+	return false
+}
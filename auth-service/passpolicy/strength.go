@@ -0,0 +1,283 @@
+package passpolicy
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// common.txt holds frequently used passwords and words, most common first
+//
+//go:embed common.txt
+var commonList string
+
+var commonRanks = func() map[string]int {
+	ranks := map[string]int{}
+	for _, w := range strings.Fields(commonList) {
+		if _, ok := ranks[w]; !ok {
+			ranks[w] = len(ranks) + 1
+		}
+	}
+	return ranks
+}()
+
+var leet = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+func unleet(s string) string {
+	return strings.Map(func(r rune) rune {
+		if plain, ok := leet[r]; ok {
+			return plain
+		}
+		return r
+	}, s)
+}
+
+var keyboardRows = []string{"1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./", "qazwsxedcrfvtgbyhnujmikolp"}
+
+// bruteforceCardinality is the guesses a character no pattern explains is
+// worth, as in zxcvbn
+const bruteforceCardinality = 10
+
+const maxEstimateLength = 256
+
+// Strength estimates how hard password is to guess, in the manner of
+// zxcvbn: it looks for the patterns attackers try first (common passwords,
+// the user's own details, sequences, repeats, keyboard walks and dates),
+// finds the cheapest way to build the password from them and returns the
+// number of guesses that takes with a score from 0 (trivial) to 4 (strong).
+func Strength(password string, userInputs []string) (int, float64) {
+	rs := []rune(strings.ToLower(password))
+	original := []rune(password)
+	if len(original) != len(rs) {
+		// Lowercasing changed the length; give up on case variations
+		original = rs
+	}
+	n := len(rs)
+	if n == 0 {
+		return 0, 1
+	}
+	if n > maxEstimateLength {
+		// Nobody guesses passwords this long, and the search is quadratic
+		return 4, math.Inf(1)
+	}
+
+	ranks := commonRanks
+	if len(userInputs) > 0 {
+		ranks = make(map[string]int, len(commonRanks)+len(userInputs))
+		for w, r := range commonRanks {
+			ranks[w] = r
+		}
+		for i, w := range userInputs {
+			ranks[strings.ToLower(w)] = i + 1
+		}
+	}
+
+	// best[j] is the fewest guesses for the first j characters
+	best := make([]float64, n+1)
+	best[0] = 1
+	for j := 1; j <= n; j++ {
+		best[j] = best[j-1] * bruteforceCardinality
+		for i := 0; i < j; i++ {
+			if g := patternGuesses(rs[i:j], original[i:j], ranks); g > 0 {
+				best[j] = math.Min(best[j], best[i]*g)
+			}
+		}
+	}
+
+	guesses := best[n]
+	switch {
+	case guesses < 1e3+5:
+		return 0, guesses
+	case guesses < 1e6+5:
+		return 1, guesses
+	case guesses < 1e8+5:
+		return 2, guesses
+	case guesses < 1e10+5:
+		return 3, guesses
+	}
+	return 4, guesses
+}
+
+// patternGuesses is the fewest guesses any known pattern needs for token,
+// or 0 if token fits none
+func patternGuesses(token, original []rune, ranks map[string]int) float64 {
+	var best float64
+	consider := func(g float64) {
+		if g > 0 && (best == 0 || g < best) {
+			best = g
+		}
+	}
+
+	if len(token) >= 3 {
+		word := string(token)
+		caseVariations := uppercaseVariations(original)
+		if r, ok := ranks[word]; ok {
+			consider(float64(r) * caseVariations)
+		}
+		if r, ok := ranks[reverse(word)]; ok {
+			consider(float64(r) * caseVariations * 2)
+		}
+		if plain := unleet(word); plain != word {
+			if r, ok := ranks[plain]; ok {
+				consider(float64(r) * caseVariations * leetVariations(word))
+			}
+		}
+		consider(sequenceGuesses(token))
+		consider(keyboardGuesses(token))
+		consider(dateGuesses(word))
+	}
+	consider(repeatGuesses(token, ranks))
+
+	// Patterns are never cheaper than a handful of guesses each
+	if best > 0 && best < 10 {
+		best = 10
+	}
+	return best
+}
+
+// uppercaseVariations counts the ways of capitalising a word that an
+// attacker tries: none, the first letter, the last or all are cheap
+func uppercaseVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1]))) {
+		return 2
+	}
+	// Any mix: the number of ways to pick which letters are upper case
+	return math.Max(binomial(upper+lower, upper), 2)
+}
+
+func leetVariations(word string) float64 {
+	subs := 0
+	for _, r := range word {
+		if _, ok := leet[r]; ok {
+			subs++
+		}
+	}
+	return math.Max(math.Pow(2, float64(subs)), 2)
+}
+
+// sequenceGuesses covers runs like abcd, 9876 or ACEG with a constant step
+func sequenceGuesses(token []rune) float64 {
+	delta := token[1] - token[0]
+	if delta == 0 || delta > 5 || delta < -5 {
+		return 0
+	}
+	for i := 2; i < len(token); i++ {
+		if token[i]-token[i-1] != delta {
+			return 0
+		}
+	}
+
+	var base float64
+	switch first := token[0]; {
+	case strings.ContainsRune("az09", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return base * float64(len(token))
+}
+
+// keyboardGuesses covers walks along a keyboard row such as qwerty
+func keyboardGuesses(token []rune) float64 {
+	if len(token) < 4 {
+		return 0
+	}
+	word := string(token)
+	for _, row := range keyboardRows {
+		if strings.Contains(row, word) || strings.Contains(row, reverse(word)) {
+			return 10 * float64(len(token))
+		}
+	}
+	return 0
+}
+
+// repeatGuesses covers a block repeated back to back, like aaaa or abcabc
+func repeatGuesses(token []rune, ranks map[string]int) float64 {
+	n := len(token)
+	for size := 1; size <= n/2; size++ {
+		if n%size != 0 || (size == 1 && n < 3) {
+			continue
+		}
+		block := token[:size]
+		repeated := true
+		for i := size; i < n; i += size {
+			if string(token[i:i+size]) != string(block) {
+				repeated = false
+				break
+			}
+		}
+		if repeated {
+			_, blockGuesses := Strength(string(block), nil)
+			if r, ok := ranks[string(block)]; ok {
+				blockGuesses = math.Min(blockGuesses, float64(r))
+			}
+			return blockGuesses * float64(n/size)
+		}
+	}
+	return 0
+}
+
+// dateGuesses covers years and all-digit dates like 1990, 310185 or 19850131
+func dateGuesses(word string) float64 {
+	if _, err := strconv.Atoi(word); err != nil {
+		return 0
+	}
+	yearSpace := func(year int) float64 {
+		return math.Max(math.Abs(float64(year-time.Now().Year())), 20)
+	}
+	switch len(word) {
+	case 4:
+		if year, _ := strconv.Atoi(word); year >= 1900 && year <= 2099 {
+			return yearSpace(year)
+		}
+	case 6, 8:
+		for _, layout := range []string{"020106", "010206", "060102", "02012006", "01022006", "20060102"} {
+			if len(layout) != len(word) {
+				continue
+			}
+			if t, err := time.Parse(layout, word); err == nil {
+				return 365 * yearSpace(t.Year())
+			}
+		}
+	}
+	return 0
+}
+
+func reverse(s string) string {
+	rs := []rune(s)
+	for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+		rs[i], rs[j] = rs[j], rs[i]
+	}
+	return string(rs)
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r *= float64(n-k+i) / float64(i)
+	}
+	return r
+}
@@ -0,0 +1,103 @@
+package passpolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrengthWeak(t *testing.T) {
+	for _, pw := range []string{
+		"password",     // most common
+		"Password1",    // common word, capitalised, digit appended
+		"p@ssw0rd",     // leet
+		"drowssap",     // reversed
+		"123456",       // common
+		"qwertyuiop",   // keyboard row
+		"abcdefgh",     // sequence
+		"aaaaaaaaaaaa", // repeat
+		"abcabcabcabc", // repeated block
+		"19850131",     // date
+	} {
+		if score, guesses := Strength(pw, nil); score > 1 {
+			t.Errorf("Strength(%q) = %d (%g guesses), want at most 1", pw, score, guesses)
+		}
+	}
+}
+
+func TestStrengthStrong(t *testing.T) {
+	for _, pw := range []string{
+		"correct horse battery staple",
+		"xK9#mQ2$vL7!pR4",
+		"g7Jk2pQz9wXr",
+	} {
+		if score, guesses := Strength(pw, nil); score != 4 {
+			t.Errorf("Strength(%q) = %d (%g guesses), want 4", pw, score, guesses)
+		}
+	}
+}
+
+func TestStrengthUserInputs(t *testing.T) {
+	const pw = "quillfeather2024"
+	_, alone := Strength(pw, nil)
+	score, withName := Strength(pw, []string{"Quillfeather"})
+	if withName >= alone {
+		t.Errorf("the user's own name didn't make %q easier: %g guesses, %g without", pw, withName, alone)
+	}
+	if score > 1 {
+		t.Errorf("Strength(%q) with the user's name = %d, want at most 1", pw, score)
+	}
+}
+
+func TestStrengthEdges(t *testing.T) {
+	if score, guesses := Strength("", nil); score != 0 || guesses != 1 {
+		t.Errorf("Strength(empty) = %d, %g", score, guesses)
+	}
+	if score, _ := Strength(strings.Repeat("a", maxEstimateLength+1), nil); score != 4 {
+		t.Errorf("overlong password scored %d, want 4", score)
+	}
+	// Guessing a longer random tail never gets easier
+	_, short := Strength("kH8tv2", nil)
+	_, long := Strength("kH8tv2Qz", nil)
+	if long <= short {
+		t.Errorf("longer password needs %g guesses, shorter %g", long, short)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	ctx := Context{Email: "jane.doe@example.com", FirstName: "Jane", LastName: "Doe"}
+	tests := []struct {
+		password string
+		rules    []string
+	}{
+		{"g7Jk2pQz9wXr", nil},
+		{"short", []string{RuleMinLength, RuleStrength}},
+		{"", []string{RuleMinLength}},
+		{"g7Jk2pQz9wXrJane", []string{RuleContext}},
+		{"g7Jk2pQz9wXrD0e!", []string{RuleContext}},
+		{"g7Jk2pQz9wXrexample", []string{RuleContext}},
+		{"passwordpassword", []string{RuleStrength}},
+		{strings.Repeat("g7Jk2pQz", 17), []string{RuleMaxLength}},
+	}
+	for _, tt := range tests {
+		err := Default.Check(tt.password, ctx)
+		if got := violatedRules(t, err); strings.Join(got, ",") != strings.Join(tt.rules, ",") {
+			t.Errorf("Check(%q) violated %v, want %v", tt.password, got, tt.rules)
+		}
+	}
+}
+
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	perr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Check returned %T, want *Error", err)
+	}
+	rules := make([]string, len(perr.Violations))
+	for i, v := range perr.Violations {
+		rules[i] = v.Rule
+	}
+	return rules
+}
@@ -0,0 +1,4 @@
+// Package authpb holds the Go bindings for shared/protos/auth.proto.
+package authpb
+
+//go:generate protoc -I ../../../shared/protos --go_out=. --go_opt=paths=source_relative,Mauth.proto=auth-service/proto/authpb --go-grpc_out=. --go-grpc_opt=paths=source_relative,Mauth.proto=auth-service/proto/authpb auth.proto
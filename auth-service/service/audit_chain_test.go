@@ -0,0 +1,147 @@
+package service
+
+import (
+	"auth-service/model"
+	"testing"
+	"time"
+)
+
+// auditChain seals n entries into a chain the way appendAuditEntry does
+func auditChain(n int) []model.AuditLog {
+	entries := make([]model.AuditLog, n)
+	prev := ""
+	at := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	for i := range entries {
+		entries[i] = model.AuditLog{
+			ID:         uint(i + 1),
+			Action:     "login",
+			Outcome:    OutcomeSuccess,
+			ActorEmail: "jane@example.com",
+			TargetType: "user",
+			TargetID:   "7",
+			IP:         "192.0.2.1",
+			Details:    `{"method":"local"}`,
+		}
+		sealAuditEntry(&entries[i], prev, at.Add(time.Duration(i)*time.Second))
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+// verifyChain runs entries through the same check VerifyAuditChain does
+func verifyChain(entries []model.AuditLog) *AuditChainReport {
+	report := &AuditChainReport{}
+	for i := range entries {
+		if !report.check(&entries[i]) {
+			break
+		}
+	}
+	return report
+}
+
+func TestAuditChainIntact(t *testing.T) {
+	entries := auditChain(5)
+	report := verifyChain(entries)
+	if !report.Intact() {
+		t.Fatalf("intact chain reported broken at %d: %s", report.BrokenID, report.Problem)
+	}
+	if report.Entries != 5 || report.HeadID != 5 || report.HeadHash != entries[4].Hash {
+		t.Errorf("report %+v, want 5 entries ending at 5", report)
+	}
+	if entries[0].PrevHash != "" {
+		t.Errorf("first entry links to %q", entries[0].PrevHash)
+	}
+	if got := entries[0].CreatedAt.Nanosecond() % 1000; got != 0 {
+		t.Errorf("created_at keeps sub-microsecond precision (%dns) the database drops", got)
+	}
+}
+
+func TestAuditChainTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]model.AuditLog) []model.AuditLog
+		broken uint
+	}{
+		{"modified action", func(e []model.AuditLog) []model.AuditLog {
+			e[2].Action = "logout"
+			return e
+		}, 3},
+		{"modified details", func(e []model.AuditLog) []model.AuditLog {
+			e[1].Details = `{"method":"ldap"}`
+			return e
+		}, 2},
+		{"modified timestamp", func(e []model.AuditLog) []model.AuditLog {
+			e[3].CreatedAt = e[3].CreatedAt.Add(time.Microsecond)
+			return e
+		}, 4},
+		{"modified actor", func(e []model.AuditLog) []model.AuditLog {
+			id := uint(1)
+			e[0].ActorID = &id
+			return e
+		}, 1},
+		{"modified and rehashed", func(e []model.AuditLog) []model.AuditLog {
+			e[1].Outcome = OutcomeFailure
+			e[1].Hash = auditHash(&e[1])
+			return e
+		}, 3},
+		{"removed entry", func(e []model.AuditLog) []model.AuditLog {
+			return append(e[:2], e[3:]...)
+		}, 4},
+		{"reordered entries", func(e []model.AuditLog) []model.AuditLog {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, 3},
+		{"unchained entry inserted", func(e []model.AuditLog) []model.AuditLog {
+			extra := model.AuditLog{ID: 3, Action: "login"}
+			return append(e[:2:2], append([]model.AuditLog{extra}, e[2:]...)...)
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := verifyChain(tt.tamper(auditChain(5)))
+			if report.Intact() {
+				t.Fatal("tampering went unnoticed")
+			}
+			if report.BrokenID != tt.broken {
+				t.Errorf("broken at %d (%s), want %d", report.BrokenID, report.Problem, tt.broken)
+			}
+		})
+	}
+}
+
+func TestAuditChainLegacyEntries(t *testing.T) {
+	legacy := []model.AuditLog{{ID: 1, Action: "login"}, {ID: 2, Action: "logout"}}
+	chained := auditChain(3)
+	for i := range chained {
+		chained[i].ID += 2
+	}
+	report := verifyChain(append(legacy, chained...))
+	if !report.Intact() {
+		t.Fatalf("broken at %d: %s", report.BrokenID, report.Problem)
+	}
+	if report.Legacy != 2 || report.Entries != 3 || report.HeadID != 5 {
+		t.Errorf("report %+v, want 2 legacy and 3 chained entries", report)
+	}
+}
+
+func TestAuditHashCoversEveryField(t *testing.T) {
+	base := auditChain(1)[0]
+	id := uint(9)
+	for name, change := range map[string]func(*model.AuditLog){
+		"prev_hash":   func(e *model.AuditLog) { e.PrevHash = "x" },
+		"outcome":     func(e *model.AuditLog) { e.Outcome = OutcomeFailure },
+		"actor_id":    func(e *model.AuditLog) { e.ActorID = &id },
+		"actor_email": func(e *model.AuditLog) { e.ActorEmail = "mallory@example.com" },
+		"target_type": func(e *model.AuditLog) { e.TargetType = "role" },
+		"target_id":   func(e *model.AuditLog) { e.TargetID = "8" },
+		"user_email":  func(e *model.AuditLog) { e.UserEmail = "x@example.com" },
+		"ip":          func(e *model.AuditLog) { e.IP = "198.51.100.1" },
+		"user_agent":  func(e *model.AuditLog) { e.UserAgent = "curl" },
+	} {
+		e := base
+		change(&e)
+		if auditHash(&e) == base.Hash {
+			t.Errorf("changing %s keeps the hash", name)
+		}
+	}
+}
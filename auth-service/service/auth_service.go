@@ -1,65 +1,247 @@
 package service
 
 import (
+	"auth-service/mailer"
 	"auth-service/model"
-	"auth-service/utils"
-	"encoding/json"
-	"golang.org/x/crypto/bcrypt"
+	"auth-service/notify"
+	"auth-service/oidc"
+	"auth-service/passpolicy"
+	"errors"
 	"gorm.io/gorm"
+	"log"
+	"strconv"
 )
 
 type AuthService struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Mailer mailer.Mailer
+	OIDC   *oidc.Client // nil when single sign-on is off
+	// Notifier tells users about suspicious logins; nil tells nobody
+	Notifier notify.Notifier
+	// Authenticators are the password backends Login tries in order. Empty
+	// means local passwords only.
+	Authenticators []Authenticator
 }
 
-// Register user with roles as JSON array
-func (s *AuthService) Register(email, password string, roles []string) error {
-	// Hash password
-	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// RegisterInput is the profile a new user signs up with
+type RegisterInput struct {
+	Email           string
+	Password        string
+	FirstName       string
+	LastName        string
+	InvitationToken string // required unless AllowSelfRegistration is on
+}
+
+// Register a user. With an invitation the user gets the invitation's roles;
+// open self-registration (when enabled) always yields a user without roles.
+func (s *AuthService) Register(in RegisterInput, client ClientInfo) (*model.User, error) {
+	if in.InvitationToken == "" && !AllowSelfRegistration {
+		return nil, ErrRegistrationClosed
+	}
+
+	if err := PasswordPolicy.Check(in.Password, passpolicy.Context{
+		Email:     in.Email,
+		FirstName: in.FirstName,
+		LastName:  in.LastName,
+	}); err != nil {
+		return nil, err
+	}
 
-	// Convert roles slice to JSON
-	rolesJSON, err := json.Marshal(roles)
+	// Hash password
+	hashed, err := Passwords.Hash(in.Password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create user struct
 	user := model.User{
-		Email:          email,
-		HashedPassword: string(hashed),
-		Roles:          string(rolesJSON), // Store as JSONB
+		Email:          in.Email,
+		HashedPassword: hashed,
+		FirstName:      in.FirstName,
+		LastName:       in.LastName,
+		Roles:          model.TextArray{},
+	}
+
+	// Insert into DB, consuming the invitation in the same transaction
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if in.InvitationToken != "" {
+			inv, err := redeemInvitation(tx, in.InvitationToken, in.Email)
+			if err != nil {
+				return err
+			}
+			user.Email = inv.Email
+			user.Roles = inv.Roles
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Insert into DB
-	return s.DB.Create(&user).Error
+	details := map[string]interface{}{"roles": user.RoleList()}
+	if in.InvitationToken != "" {
+		details["invited"] = true
+	}
+	s.audit(AuditEvent{
+		Action:  "register",
+		Actor:   actorFor(&user, client),
+		User:    &user,
+		Details: details,
+	})
+	return &user, nil
 }
 
-// Login user and generate token
-func (s *AuthService) Login(email, password string) (string, error) {
+// GetUser loads a user by ID
+func (s *AuthService) GetUser(id uint) (*model.User, error) {
 	var user model.User
+	if err := s.DB.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login user and issue an access/refresh token pair, or an MFA challenge when
+// the account has MFA enabled. The session acts in orgID, which the user must
+// belong to; with 0 it picks the user's only organization, if any. Every
+// failure comes back as ErrInvalidCredentials, except ErrTooManyAttempts
+// while backing off, ErrNotMember for a wrong organization and errors of a
+// backend that couldn't be asked.
+func (s *AuthService) Login(email, password string, orgID uint, client ClientInfo) (*LoginResult, error) {
+	keys := throttleKeys(email, client)
+	if err := s.checkThrottle(keys); err != nil {
+		if _, ok := IsTooManyAttempts(err); ok {
+			s.auditLoginFailure(email, nil, client, "throttled")
+		}
+		return nil, err
+	}
 
-	// Find user by email
-	if err := s.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return "", err
+	// Check the password with each backend in turn
+	user, backend, err := s.authenticate(email, password, client)
+	switch {
+	case errors.Is(err, ErrUnknownUser):
+		s.recordFailures(keys)
+		s.auditLoginFailure(email, nil, client, "unknown_user")
+		return nil, ErrInvalidCredentials
+	case errors.Is(err, ErrInvalidCredentials):
+		s.recordFailures(keys)
+		if user != nil {
+			s.recordAccountFailure(user)
+		}
+		s.auditLoginFailure(email, user, client, "wrong_password")
+		return nil, ErrInvalidCredentials
+	case err != nil:
+		s.auditLoginFailure(email, nil, client, "backend_error")
+		return nil, err
 	}
 
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)); err != nil {
-		return "", err
+	// Locked and disabled accounts stay shut even with the right password
+	if user.LockedAt != nil || user.DisabledAt != nil {
+		s.recordFailures(keys)
+		reason := "locked"
+		if user.DisabledAt != nil {
+			reason = "disabled"
+		}
+		s.auditLoginFailure(email, user, client, reason)
+		return nil, ErrInvalidCredentials
 	}
 
-	// Unmarshal roles JSON into []string
-	var roles []string
-	_ = json.Unmarshal([]byte(user.Roles), &roles)
+	return s.finishLogin(user, backend, orgID, keys[0], client)
+}
 
-	// Generate JWT with roles
-	token, _ := utils.GenerateJWT(user.ID, user.Email, roles)
+// finishLogin signs user in once their first factor checked out: it judges
+// the login's risk, picks the organization and issues either tokens or a
+// challenge for a second factor. throttleKey is the email key failed
+// attempts were counted under.
+func (s *AuthService) finishLogin(user *model.User, method string, orgID uint, throttleKey string, client ClientInfo) (*LoginResult, error) {
+	// Judge the login against earlier ones before its failures are forgotten
+	var risk *riskAssessment
+	if Risk.Enabled {
+		var err error
+		if risk, err = s.assessLogin(user, throttleKey, client); err != nil {
+			// A broken evaluator must not lock everyone out
+			log.Printf("Failed to assess login risk for %s: %v", user.Email, err)
+		}
+	}
+
+	orgID, err := loginOrg(s.DB, user.ID, orgID)
+	if err != nil {
+		if errors.Is(err, ErrNotMember) {
+			s.auditLoginFailure(user.Email, user, client, "not_member")
+		}
+		return nil, err
+	}
+	s.flagLogin(user, risk, client)
+
+	// The first factor alone isn't enough, hand out a challenge for the
+	// second. Risky logins of users without MFA get a code by email. Failed
+	// attempts stay on record until the second factor checks out too.
+	if user.MFAEnabled || risk.stepUp() {
+		factor := MFAMethodTOTP
+		if !user.MFAEnabled {
+			factor = MFAMethodEmail
+		}
+		challenge, err := s.createMFAChallenge(user, orgID, factor)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: challenge, MFAMethod: factor}, nil
+	}
+
+	s.clearFailures(user, throttleKey)
+
+	// Generate JWT with roles and start a refresh token family
+	pair, err := s.startSession(user, orgID, client)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberLogin(user.ID, client)
 
 	// Save audit log
-	s.DB.Create(&model.AuditLog{
-		Action:    "login",
-		UserEmail: user.Email,
+	s.audit(AuditEvent{
+		Action:  "login",
+		Actor:   actorFor(user, client),
+		User:    user,
+		Details: loginDetails(map[string]interface{}{"method": method}, orgID),
 	})
 
-	return token, nil
+	return &LoginResult{Tokens: pair}, nil
+}
+
+// clearFailures forgets the failed attempts of a user who just signed in
+func (s *AuthService) clearFailures(user *model.User, throttleKey string) {
+	s.clearThrottle(throttleKey)
+	if user.FailedLogins > 0 {
+		s.DB.Model(user).Update("failed_logins", 0)
+	}
+}
+
+// loginDetails adds the organization a login acts in to its audit details
+func loginDetails(details map[string]interface{}, orgID uint) map[string]interface{} {
+	if orgID != 0 {
+		details["org"] = strconv.FormatUint(uint64(orgID), 10)
+	}
+	return details
+}
+
+func (s *AuthService) recordFailures(keys []string) {
+	for _, key := range keys {
+		s.recordFailure(key)
+	}
+}
+
+// auditLoginFailure records a failed login for email; user is nil when no
+// such account exists
+func (s *AuthService) auditLoginFailure(email string, user *model.User, client ClientInfo, reason string) {
+	e := AuditEvent{
+		Action:    "login_failed",
+		Outcome:   OutcomeFailure,
+		Actor:     Actor{Client: client},
+		User:      user,
+		UserEmail: email,
+		Details:   map[string]interface{}{"reason": reason},
+	}
+	if user != nil {
+		e.Actor = actorFor(user, client)
+	}
+	s.audit(e)
 }
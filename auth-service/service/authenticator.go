@@ -0,0 +1,158 @@
+package service
+
+import (
+	"auth-service/directory"
+	"auth-service/model"
+	"errors"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownUser tells Login that a backend doesn't know a login, so the
+// next one should try
+var ErrUnknownUser = errors.New("unknown user")
+
+// Authenticator checks a login and password against one user store.
+// AuthService.Login asks each of its Authenticators in turn.
+type Authenticator interface {
+	// Name identifies the backend in the audit log
+	Name() string
+	// Authenticate returns the local user the credentials belong to. It
+	// returns ErrUnknownUser when the store doesn't know login, and
+	// ErrInvalidCredentials when the password is wrong, together with the
+	// local user if there is one so the failure counts against them.
+	Authenticate(login, password string, client ClientInfo) (*model.User, error)
+}
+
+// authenticate asks each backend in turn. When none accepts the password it
+// returns the user whose password was wrong, if any backend knew them.
+func (s *AuthService) authenticate(login, password string, client ClientInfo) (*model.User, string, error) {
+	backends := s.Authenticators
+	if len(backends) == 0 {
+		backends = []Authenticator{LocalAuthenticator{DB: s.DB}}
+	}
+
+	var known *model.User
+	failure := ErrUnknownUser
+	for _, a := range backends {
+		user, err := a.Authenticate(login, password, client)
+		switch {
+		case err == nil:
+			return user, a.Name(), nil
+		case errors.Is(err, ErrUnknownUser):
+		case errors.Is(err, ErrInvalidCredentials):
+			failure = ErrInvalidCredentials
+			if known == nil {
+				known = user
+			}
+		default:
+			// An unreachable directory mustn't lock out local users
+			log.Printf("Login backend %s failed: %v", a.Name(), err)
+			if failure == ErrUnknownUser {
+				failure = err
+			}
+		}
+	}
+	return known, "", failure
+}
+
+// LocalAuthenticator checks the password hashes stored with model.User.
+// Hashes made by a legacy hasher or with old parameters are replaced once
+// the password has been seen to match.
+type LocalAuthenticator struct {
+	DB *gorm.DB
+}
+
+func (LocalAuthenticator) Name() string { return "local" }
+
+func (a LocalAuthenticator) Authenticate(login, password string, _ ClientInfo) (*model.User, error) {
+	var user model.User
+	if err := a.DB.Where("email = ?", login).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		compareDummyPassword(password)
+		return nil, ErrUnknownUser
+	}
+	// Users from single sign-on or a directory have no password here
+	if user.HashedPassword == "" {
+		compareDummyPassword(password)
+		return nil, ErrUnknownUser
+	}
+	ok, rehash, err := Passwords.Verify(user.HashedPassword, password)
+	if err != nil || !ok {
+		return &user, ErrInvalidCredentials
+	}
+	if rehash {
+		a.rehash(&user, password)
+	}
+	return &user, nil
+}
+
+// rehash upgrades the stored hash of user. A failure only means the old
+// hash stays until the next login.
+func (a LocalAuthenticator) rehash(user *model.User, password string) {
+	hashed, err := Passwords.Hash(password)
+	if err == nil {
+		// Guard on the old hash so a password changed meanwhile is kept
+		err = a.DB.Model(&model.User{}).
+			Where("id = ? AND hashed_password = ?", user.ID, user.HashedPassword).
+			Update("hashed_password", hashed).Error
+	}
+	if err != nil {
+		log.Printf("rehash password of user %d: %v", user.ID, err)
+		return
+	}
+	user.HashedPassword = hashed
+}
+
+// LDAPAuthenticator checks passwords against an LDAP directory or Active
+// Directory. Users are linked to their directory entry, created on first
+// login when AutoProvision is on, and get the roles GroupRoles maps their
+// groups to on every login.
+type LDAPAuthenticator struct {
+	DB            *gorm.DB
+	Directory     *directory.Client
+	GroupRoles    map[string][]string
+	AutoProvision bool
+}
+
+func (LDAPAuthenticator) Name() string { return "ldap" }
+
+func (a LDAPAuthenticator) Authenticate(login, password string, client ClientInfo) (*model.User, error) {
+	entry, err := a.Directory.Authenticate(login, password)
+	switch {
+	case errors.Is(err, directory.ErrUserNotFound):
+		return nil, ErrUnknownUser
+	case errors.Is(err, directory.ErrInvalidCredentials):
+		if entry == nil {
+			return nil, ErrInvalidCredentials
+		}
+		return findExternalUser(a.DB, a.externalUser(entry)), ErrInvalidCredentials
+	case err != nil:
+		return nil, err
+	}
+
+	user, _, err := provisionExternalUser(a.DB, a.externalUser(entry), a.GroupRoles, a.AutoProvision, client)
+	// An admin's account isn't linked to the directory; their local
+	// password is next
+	if errors.Is(err, ErrNoAccount) || errors.Is(err, ErrPrivilegedLink) {
+		return nil, ErrUnknownUser
+	}
+	return user, err
+}
+
+func (a LDAPAuthenticator) externalUser(entry *directory.Entry) externalUser {
+	return externalUser{
+		Method:  "ldap",
+		Issuer:  "ldap:" + a.Directory.Config.BaseDN,
+		Subject: entry.ID,
+		Email:   entry.Email,
+		// The directory is the organization's own record of its people
+		EmailVerified: true,
+		FirstName:     entry.FirstName,
+		LastName:      entry.LastName,
+		Groups:        entry.Groups,
+	}
+}
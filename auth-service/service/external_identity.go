@@ -0,0 +1,181 @@
+package service
+
+import (
+	"auth-service/model"
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoAccount       = errors.New("no account exists for this identity")
+	ErrUnverifiedEmail = errors.New("an account with this email exists but the identity provider did not verify the email")
+	ErrPrivilegedLink  = errors.New("an account with this email holds a privileged role and is never linked to an identity provider automatically")
+)
+
+// externalUser is a user as an external identity provider or directory
+// describes them
+type externalUser struct {
+	Method        string // "oidc", "ldap"; recorded in the audit log
+	Issuer        string
+	Subject       string // stable ID at the issuer
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Groups        []string
+}
+
+// provisionExternalUser finds the user behind an external identity, linking
+// or creating one as needed, and brings the roles groupRoles manages up to
+// date. It reports whether the user was created.
+func provisionExternalUser(db *gorm.DB, ext externalUser, groupRoles map[string][]string, autoProvision bool, client ClientInfo) (*model.User, bool, error) {
+	var user model.User
+	created := false
+	var oldRoles []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var link model.ExternalIdentity
+		err := tx.Where("issuer = ? AND subject = ?", ext.Issuer, ext.Subject).First(&link).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, link.UserID).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if ext.Email == "" {
+				return ErrNoAccount
+			}
+			err := tx.Where("email = ?", ext.Email).First(&user).Error
+			switch {
+			case err == nil:
+				// Only trust the provider with an existing account when it
+				// vouches for the address
+				if !ext.EmailVerified {
+					return ErrUnverifiedEmail
+				}
+				// Nor with an admin's account: a provider account under
+				// the same email would take it over
+				privileged, err := holdsPrivilegedRole(tx, &user)
+				if err != nil {
+					return err
+				}
+				if privileged {
+					return ErrPrivilegedLink
+				}
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if !autoProvision {
+					return ErrNoAccount
+				}
+				// No password: an empty hash never matches, so the user
+				// can only sign in through the provider until they reset it
+				user = model.User{
+					Email:     ext.Email,
+					FirstName: ext.FirstName,
+					LastName:  ext.LastName,
+					Roles:     model.TextArray{},
+				}
+				if err := tx.Create(&user).Error; err != nil {
+					return err
+				}
+				created = true
+			default:
+				return err
+			}
+			if err := tx.Create(&model.ExternalIdentity{
+				UserID:  user.ID,
+				Issuer:  ext.Issuer,
+				Subject: ext.Subject,
+			}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		oldRoles = user.RoleList()
+		roles, changed := syncGroupRoles(oldRoles, ext.Groups, groupRoles)
+		if !changed {
+			return nil
+		}
+		return tx.Model(&user).Update("roles", cleanRoles(roles)).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		writeAudit(db, AuditEvent{
+			Action:  "register",
+			Actor:   actorFor(&user, client),
+			User:    &user,
+			Details: map[string]interface{}{"method": ext.Method, "roles": user.RoleList()},
+		})
+	} else if !sameStrings(oldRoles, user.RoleList()) {
+		writeAudit(db, AuditEvent{
+			Action:  "user_roles_updated",
+			Actor:   Actor{Email: ext.Method + ":" + ext.Issuer, Client: client},
+			User:    &user,
+			Details: map[string]interface{}{"old_roles": oldRoles, "new_roles": user.RoleList(), "groups": ext.Groups},
+		})
+	}
+	return &user, created, nil
+}
+
+// findExternalUser returns the user linked to an external identity, or
+// failing that the user with its email, or nil
+func findExternalUser(db *gorm.DB, ext externalUser) *model.User {
+	var user model.User
+	var link model.ExternalIdentity
+	if db.Where("issuer = ? AND subject = ?", ext.Issuer, ext.Subject).First(&link).Error == nil {
+		if db.First(&user, link.UserID).Error == nil {
+			return &user
+		}
+	}
+	if ext.Email != "" && db.Where("email = ?", ext.Email).First(&user).Error == nil {
+		return &user
+	}
+	return nil
+}
+
+// syncGroupRoles replaces the roles managed by mapping with those the groups
+// grant, keeping every other role. It reports whether anything changed.
+func syncGroupRoles(current, groups []string, mapping map[string][]string) ([]string, bool) {
+	if len(mapping) == 0 {
+		return current, false
+	}
+
+	managed := map[string]bool{}
+	for _, roles := range mapping {
+		for _, r := range roles {
+			managed[r] = true
+		}
+	}
+	var roles []string
+	for _, r := range current {
+		if !managed[r] {
+			roles = append(roles, r)
+		}
+	}
+	for _, g := range groups {
+		roles = append(roles, mapping[g]...)
+	}
+	roles = uniqueStrings(roles)
+	return roles, !sameStrings(current, roles)
+}
+
+// sameStrings reports whether a and b hold the same strings in any order
+func sameStrings(a, b []string) bool {
+	a, b = uniqueStrings(a), uniqueStrings(b)
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
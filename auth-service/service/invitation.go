@@ -0,0 +1,198 @@
+package service
+
+import (
+	"auth-service/mailer"
+	"auth-service/model"
+	"auth-service/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration requires an invitation")
+	ErrInvalidInvitation  = errors.New("invalid, used or expired invitation")
+)
+
+var (
+	// AllowSelfRegistration lets people sign up without an invitation. Such
+	// users never get roles; an admin has to grant them.
+	AllowSelfRegistration = false
+	// InvitationTTL is how long an invitation stays valid when none is given
+	InvitationTTL = 72 * time.Hour
+	// InvitationURL is the link mailed to invitees; %s is replaced with the token
+	InvitationURL = "http://localhost:3000/register?invitation=%s"
+)
+
+// CreateInvitation invites email to register with roles, mails them the link
+// and returns the invitation together with its token (shown only once)
+func (s *AuthService) CreateInvitation(actor Actor, email string, roles []string, ttl time.Duration) (*model.Invitation, string, error) {
+	// Invitees get their roles outside any organization
+	if actor.OrgID != 0 {
+		return nil, "", ErrOrgScoped
+	}
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, "", errors.New("email is required")
+	}
+	if ttl <= 0 {
+		ttl = InvitationTTL
+	}
+
+	if err := s.validateRoles(roles); err != nil {
+		return nil, "", err
+	}
+	if err := s.checkGrantable(actor, roles); err != nil {
+		return nil, "", err
+	}
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	inv := model.Invitation{
+		Email:       email,
+		Roles:       cleanRoles(roles),
+		TokenHash:   utils.HashToken(token),
+		ExpiresAt:   time.Now().Add(ttl),
+		CreatedByID: actor.UserID,
+	}
+	if err := s.DB.Create(&inv).Error; err != nil {
+		return nil, "", err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "invitation_created",
+		Actor:      actor,
+		UserEmail:  inv.Email,
+		TargetType: "invitation",
+		TargetID:   strconv.FormatUint(uint64(inv.ID), 10),
+		Details:    map[string]interface{}{"roles": inv.RoleList(), "expires_at": inv.ExpiresAt},
+	})
+
+	if err := s.Mailer.Send(mailer.Message{
+		To:      inv.Email,
+		Subject: "You're invited to the Talent Management platform",
+		Body: fmt.Sprintf("You have been invited to create an account.\n\n"+
+			"Use this link before %s to register:\n%s",
+			inv.ExpiresAt.UTC().Format(time.RFC1123), fmt.Sprintf(InvitationURL, token)),
+	}); err != nil {
+		log.Printf("Failed to send invitation mail to %s: %v", inv.Email, err)
+	}
+
+	return &inv, token, nil
+}
+
+// ListInvitations returns all invitations, newest first
+func (s *AuthService) ListInvitations() ([]model.Invitation, error) {
+	var invs []model.Invitation
+	err := s.DB.Order("created_at DESC").Find(&invs).Error
+	return invs, err
+}
+
+// RevokeInvitation makes an unused invitation unusable
+func (s *AuthService) RevokeInvitation(actor Actor, id uint) error {
+	var inv model.Invitation
+	if err := s.DB.First(&inv, id).Error; err != nil {
+		return err
+	}
+	if inv.UsedAt != nil || inv.RevokedAt != nil {
+		return ErrInvalidInvitation
+	}
+	if err := s.DB.Model(&inv).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "invitation_revoked",
+		Actor:      actor,
+		UserEmail:  inv.Email,
+		TargetType: "invitation",
+		TargetID:   strconv.FormatUint(uint64(inv.ID), 10),
+	})
+	return nil
+}
+
+// EnsureAdmin creates an Admin account for email unless it already exists,
+// so a fresh deployment has someone who can send the first invitations
+func (s *AuthService) EnsureAdmin(email, password string) error {
+	if password == "" {
+		return errors.New("a password is required for the bootstrap admin")
+	}
+
+	var count int64
+	if err := s.DB.Model(&model.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	hashed, err := Passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	user := model.User{
+		Email:          email,
+		HashedPassword: hashed,
+		Roles:          model.TextArray{"Admin"},
+	}
+	if err := s.DB.Create(&user).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Created bootstrap admin %s", email)
+	s.audit(AuditEvent{
+		Action: "bootstrap_admin_created",
+		User:   &user,
+	})
+	return nil
+}
+
+// redeemInvitation marks the invitation for token used by email and returns it
+func redeemInvitation(tx *gorm.DB, token, email string) (*model.Invitation, error) {
+	var inv model.Invitation
+	res := tx.Model(&inv).
+		Where("token_hash = ? AND LOWER(email) = LOWER(?) AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+			utils.HashToken(token), email, time.Now()).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidInvitation
+	}
+
+	if err := tx.Where("token_hash = ?", utils.HashToken(token)).First(&inv).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// cleanRoles trims and de-duplicates roles for storage
+func cleanRoles(roles []string) model.TextArray {
+	clean := model.TextArray{}
+	seen := map[string]bool{}
+	for _, r := range roles {
+		r = strings.TrimSpace(r)
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		clean = append(clean, r)
+	}
+	return clean
+}
+
+// encodeScopes trims and de-duplicates scopes and encodes them as a JSON
+// array for storage
+func encodeScopes(scopes []string) (string, error) {
+	b, err := json.Marshal(cleanRoles(scopes))
+	return string(b), err
+}
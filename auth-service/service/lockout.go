@@ -0,0 +1,203 @@
+package service
+
+import (
+	"auth-service/model"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClientInfo describes where a request came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	DeviceID  string // stable ID a client app sends for its device, if any
+}
+
+// LockoutPolicy tunes brute-force protection on login
+type LockoutPolicy struct {
+	MaxAccountFailures int           // consecutive failures before an account is locked until an admin unlocks it
+	EmailBackoffAfter  int           // failures for one email before each further attempt is delayed
+	IPBackoffAfter     int           // failures from one IP before each further attempt is delayed
+	BaseDelay          time.Duration // first delay; doubles with every further failure
+	MaxDelay           time.Duration
+	FailureWindow      time.Duration // failures older than this are forgotten
+}
+
+var Lockout = LockoutPolicy{
+	MaxAccountFailures: 10,
+	EmailBackoffAfter:  3,
+	IPBackoffAfter:     20,
+	BaseDelay:          time.Second,
+	MaxDelay:           15 * time.Minute,
+	FailureWindow:      time.Hour,
+}
+
+// ErrTooManyAttempts is returned while an email or IP is backing off
+type ErrTooManyAttempts struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrTooManyAttempts) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// compareDummyPassword burns the same hashing work as a real comparison so
+// unknown and locked accounts can't be told apart by timing
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = Passwords.Hash("not-a-real-password")
+	})
+	_, _, _ = Passwords.Verify(dummyHash, password)
+}
+
+func throttleKeys(email string, client ClientInfo) []string {
+	keys := []string{"email:" + strings.ToLower(strings.TrimSpace(email))}
+	if client.IP != "" {
+		keys = append(keys, "ip:"+client.IP)
+	}
+	return keys
+}
+
+// checkThrottle returns ErrTooManyAttempts if any of keys is still blocked
+func (s *AuthService) checkThrottle(keys []string) error {
+	var blocked []model.LoginThrottle
+	if err := s.DB.Where("key IN ? AND blocked_until > ?", keys, time.Now()).
+		Find(&blocked).Error; err != nil {
+		return err
+	}
+
+	var wait time.Duration
+	for _, t := range blocked {
+		if d := time.Until(*t.BlockedUntil); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return &ErrTooManyAttempts{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailure bumps the failure counter of key and starts or extends its backoff
+func (s *AuthService) recordFailure(key string) {
+	threshold := Lockout.EmailBackoffAfter
+	if strings.HasPrefix(key, "ip:") {
+		threshold = Lockout.IPBackoffAfter
+	}
+
+	var started bool
+	_ = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginThrottle{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var t model.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&t).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if now.Sub(t.LastFailureAt) > Lockout.FailureWindow {
+			t.Failures = 0
+		}
+		t.Failures++
+		t.LastFailureAt = now
+
+		if over := t.Failures - threshold; over >= 0 {
+			delay := Lockout.MaxDelay
+			if over < 30 {
+				delay = Lockout.BaseDelay << over
+			}
+			if delay > Lockout.MaxDelay || delay <= 0 {
+				delay = Lockout.MaxDelay
+			}
+			until := now.Add(delay)
+			t.BlockedUntil = &until
+			started = over == 0
+		}
+		return tx.Save(&t).Error
+	})
+
+	if started {
+		e := AuditEvent{
+			Action:     "login_throttled",
+			TargetType: "throttle",
+			TargetID:   key,
+		}
+		if strings.HasPrefix(key, "email:") {
+			e.UserEmail = strings.TrimPrefix(key, "email:")
+		}
+		s.audit(e)
+	}
+}
+
+// clearThrottle forgets the failures of key
+func (s *AuthService) clearThrottle(key string) {
+	s.DB.Where("key = ?", key).Delete(&model.LoginThrottle{})
+}
+
+// recordAccountFailure counts a wrong password against user and locks the
+// account once the limit is reached
+func (s *AuthService) recordAccountFailure(user *model.User) {
+	res := s.DB.Model(&model.User{}).Where("id = ?", user.ID).
+		Update("failed_logins", gorm.Expr("failed_logins + 1"))
+	if res.Error != nil {
+		return
+	}
+
+	res = s.DB.Model(&model.User{}).
+		Where("id = ? AND locked_at IS NULL AND failed_logins >= ?", user.ID, Lockout.MaxAccountFailures).
+		Update("locked_at", time.Now())
+	if res.Error == nil && res.RowsAffected > 0 {
+		s.audit(AuditEvent{
+			Action:  "account_locked",
+			User:    user,
+			Details: map[string]interface{}{"failed_logins": Lockout.MaxAccountFailures},
+		})
+	}
+}
+
+// UnlockUser lifts an account lock and clears its failure history
+func (s *AuthService) UnlockUser(actor Actor, userID uint) error {
+	user, err := s.accountAdminUser(actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.DB.Model(user).Updates(map[string]interface{}{
+		"locked_at":     nil,
+		"failed_logins": 0,
+	}).Error; err != nil {
+		return err
+	}
+	s.clearThrottle("email:" + strings.ToLower(user.Email))
+
+	s.audit(AuditEvent{
+		Action: "account_unlocked",
+		Actor:  actor,
+		User:   user,
+	})
+	return nil
+}
+
+// IsTooManyAttempts reports whether err is a login backoff, and for how long
+func IsTooManyAttempts(err error) (time.Duration, bool) {
+	var e *ErrTooManyAttempts
+	if errors.As(err, &e) {
+		return e.RetryAfter, true
+	}
+	return 0, false
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"auth-service/geoip"
+	"auth-service/model"
+	"auth-service/notify"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Signals the login risk evaluator can raise
+const (
+	SignalNewDevice        = "new_device"
+	SignalNewNetwork       = "new_network"
+	SignalImpossibleTravel = "impossible_travel"
+	SignalFailureBurst     = "failure_burst"
+)
+
+// RiskPolicy tunes how password logins are judged. A login scores the sum
+// of the weights of the signals it raises; any score above zero is recorded
+// as a security event.
+type RiskPolicy struct {
+	Enabled bool
+	Weights map[string]int
+	// FailureBurst is how many failed attempts for the account, and
+	// IPFailureBurst from the client's address, within
+	// Lockout.FailureWindow raise failure_burst
+	FailureBurst   int
+	IPFailureBurst int
+	// MaxTravelSpeed in km/h; going faster between two logins raises
+	// impossible_travel, unless they are less than MinTravelDistance km
+	// apart, which GeoIP can't tell apart anyway
+	MaxTravelSpeed    float64
+	MinTravelDistance float64
+	// StepUpScore is the score from which a second factor is demanded, by
+	// email for users without MFA; 0 never steps up
+	StepUpScore int
+	// NotifyScore is the score from which the user is told; 0 never tells
+	NotifyScore int
+	// History is how long logins are remembered as the baseline
+	History time.Duration
+}
+
+var Risk = RiskPolicy{
+	Enabled: true,
+	Weights: map[string]int{
+		SignalNewDevice:        1,
+		SignalNewNetwork:       1,
+		SignalImpossibleTravel: 3,
+		SignalFailureBurst:     2,
+	},
+	FailureBurst:      5,
+	IPFailureBurst:    20,
+	MaxTravelSpeed:    1000,
+	MinTravelDistance: 300,
+	NotifyScore:       2,
+	History:           90 * 24 * time.Hour,
+}
+
+// GeoIP locates login addresses for impossible-travel checks; nil turns
+// them off
+var GeoIP *geoip.DB
+
+// riskAssessment is what the evaluator made of one login
+type riskAssessment struct {
+	Signals  []string
+	Score    int
+	Location string
+}
+
+func (r *riskAssessment) stepUp() bool {
+	return r != nil && Risk.StepUpScore > 0 && r.Score >= Risk.StepUpScore
+}
+
+// assessLogin compares a login of user with their earlier ones. throttleKey
+// is the email key the login's failures were counted under.
+func (s *AuthService) assessLogin(user *model.User, throttleKey string, client ClientInfo) (*riskAssessment, error) {
+	now := time.Now()
+	rec := newLoginRecord(user.ID, client)
+	risk := &riskAssessment{}
+	if rec.Latitude != nil {
+		risk.Location = geoip.Location{Country: rec.Country, City: rec.City}.String()
+	}
+
+	var history int64
+	if err := s.DB.Model(&model.LoginRecord{}).Where("user_id = ?", user.ID).Count(&history).Error; err != nil {
+		return nil, err
+	}
+	// A first login has nothing to be new against
+	if history > 0 {
+		var known int64
+		if err := s.DB.Model(&model.LoginRecord{}).
+			Where("user_id = ? AND device_hash = ?", user.ID, rec.DeviceHash).
+			Count(&known).Error; err != nil {
+			return nil, err
+		}
+		if known == 0 {
+			risk.Signals = append(risk.Signals, SignalNewDevice)
+		}
+		if rec.Network != "" {
+			if err := s.DB.Model(&model.LoginRecord{}).
+				Where("user_id = ? AND network = ?", user.ID, rec.Network).
+				Count(&known).Error; err != nil {
+				return nil, err
+			}
+			if known == 0 {
+				risk.Signals = append(risk.Signals, SignalNewNetwork)
+			}
+		}
+	}
+
+	if rec.Latitude != nil {
+		var last model.LoginRecord
+		err := s.DB.Where("user_id = ? AND latitude IS NOT NULL", user.ID).
+			Order("created_at DESC").First(&last).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return nil, err
+		case impossibleTravel(&last, &rec, now):
+			risk.Signals = append(risk.Signals, SignalImpossibleTravel)
+		}
+	}
+
+	burst, err := s.failureBurst(throttleKey, client, now)
+	if err != nil {
+		return nil, err
+	}
+	if burst {
+		risk.Signals = append(risk.Signals, SignalFailureBurst)
+	}
+
+	for _, signal := range risk.Signals {
+		risk.Score += Risk.Weights[signal]
+	}
+	return risk, nil
+}
+
+// impossibleTravel reports whether getting from the place of last to the
+// place of next in the time between them is faster than anyone travels
+func impossibleTravel(last, next *model.LoginRecord, now time.Time) bool {
+	distance := geoip.Distance(
+		geoip.Location{Latitude: *last.Latitude, Longitude: *last.Longitude},
+		geoip.Location{Latitude: *next.Latitude, Longitude: *next.Longitude},
+	)
+	if distance < Risk.MinTravelDistance {
+		return false
+	}
+	hours := now.Sub(last.CreatedAt).Hours()
+	return hours <= 0 || distance/hours > Risk.MaxTravelSpeed
+}
+
+// failureBurst reports whether the account or the client's address saw
+// many failed logins recently
+func (s *AuthService) failureBurst(throttleKey string, client ClientInfo, now time.Time) (bool, error) {
+	limits := map[string]int{throttleKey: Risk.FailureBurst}
+	if client.IP != "" {
+		limits["ip:"+client.IP] = Risk.IPFailureBurst
+	}
+	for key, limit := range limits {
+		if limit <= 0 {
+			continue
+		}
+		var t model.LoginThrottle
+		err := s.DB.Where("key = ? AND last_failure_at > ?", key, now.Add(-Lockout.FailureWindow)).First(&t).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if t.Failures >= limit {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// flagLogin records a risky login as a security event, audits it and
+// tells the user when it is risky enough
+func (s *AuthService) flagLogin(user *model.User, risk *riskAssessment, client ClientInfo) {
+	if risk == nil || risk.Score == 0 {
+		return
+	}
+	signals, _ := json.Marshal(risk.Signals)
+	event := model.SecurityEvent{
+		UserID:    user.ID,
+		Kind:      "suspicious_login",
+		Signals:   string(signals),
+		Score:     risk.Score,
+		StepUp:    risk.stepUp(),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Location:  risk.Location,
+	}
+	if err := s.DB.Create(&event).Error; err != nil {
+		log.Printf("Failed to record security event for %s: %v", user.Email, err)
+	}
+
+	s.audit(AuditEvent{
+		Action: "suspicious_login",
+		Actor:  actorFor(user, client),
+		User:   user,
+		Details: map[string]interface{}{
+			"signals":  risk.Signals,
+			"score":    risk.Score,
+			"step_up":  event.StepUp,
+			"location": risk.Location,
+		},
+	})
+
+	if s.Notifier == nil || Risk.NotifyScore <= 0 || risk.Score < Risk.NotifyScore {
+		return
+	}
+	where := client.IP
+	if risk.Location != "" {
+		where = risk.Location + " (" + client.IP + ")"
+	}
+	if err := s.Notifier.Notify(notify.Notice{
+		Kind:    event.Kind,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Subject: "Unusual sign-in to your account",
+		Body: fmt.Sprintf("Your account was just signed in to from a place or device we haven't seen before.\n\n"+
+			"When: %s\nWhere: %s\nDevice: %s\nWhy it stood out: %s\n\n"+
+			"If this was you, there is nothing to do. If it wasn't, change your password right away "+
+			"and sign out your other sessions.",
+			time.Now().UTC().Format(time.RFC1123), where, client.UserAgent, describeSignals(risk.Signals)),
+	}); err != nil {
+		log.Printf("Failed to notify %s of a suspicious login: %v", user.Email, err)
+	}
+}
+
+func describeSignals(signals []string) string {
+	text := map[string]string{
+		SignalNewDevice:        "new device",
+		SignalNewNetwork:       "new network",
+		SignalImpossibleTravel: "too far from your last sign-in to have travelled since",
+		SignalFailureBurst:     "many failed attempts just before",
+	}
+	out := make([]string, len(signals))
+	for i, s := range signals {
+		out[i] = text[s]
+	}
+	return strings.Join(out, ", ")
+}
+
+// rememberLogin adds a successful login of userID to the baseline and
+// forgets logins older than Risk.History
+func (s *AuthService) rememberLogin(userID uint, client ClientInfo) {
+	if !Risk.Enabled {
+		return
+	}
+	rec := newLoginRecord(userID, client)
+	if err := s.DB.Create(&rec).Error; err != nil {
+		log.Printf("Failed to record login of user %d: %v", userID, err)
+		return
+	}
+	s.DB.Where("user_id = ? AND created_at < ?", userID, time.Now().Add(-Risk.History)).Delete(&model.LoginRecord{})
+}
+
+func newLoginRecord(userID uint, client ClientInfo) model.LoginRecord {
+	rec := model.LoginRecord{
+		UserID:     userID,
+		DeviceHash: deviceHash(client),
+		Network:    network(client.IP),
+		IP:         client.IP,
+	}
+	if GeoIP != nil {
+		if loc, ok := GeoIP.Lookup(client.IP); ok {
+			rec.Country, rec.City = loc.Country, loc.City
+			rec.Latitude, rec.Longitude = &loc.Latitude, &loc.Longitude
+		}
+	}
+	return rec
+}
+
+// deviceHash fingerprints the client's device: its device ID when it sends
+// one, else its user agent
+func deviceHash(client ClientInfo) string {
+	fingerprint := "ua:" + client.UserAgent
+	if client.DeviceID != "" {
+		fingerprint = "id:" + client.DeviceID
+	}
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// network is the /24 of an IPv4 or the /48 of an IPv6 address, roughly one
+// provider's customer range
+func network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+// ListSecurityEvents returns security events, newest first, only those of
+// userID unless it is 0
+func (s *AuthService) ListSecurityEvents(userID uint, limit int) ([]model.SecurityEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	q := s.DB.Order("created_at DESC").Limit(limit)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var events []model.SecurityEvent
+	err := q.Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"auth-service/mailer"
+	"auth-service/model"
+	"auth-service/utils"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMagicLinksDisabled = errors.New("magic link login is disabled")
+	ErrInvalidMagicLink   = errors.New("invalid or expired magic link")
+)
+
+var (
+	// MagicLinksEnabled turns passwordless login by email on
+	MagicLinksEnabled = false
+	// MagicLinkTTL is how long a mailed login link stays usable
+	MagicLinkTTL = 10 * time.Minute
+	// MagicLinkURL is the link mailed to users; %s is replaced with the token
+	MagicLinkURL = "http://localhost:3000/login/magic?token=%s"
+)
+
+// RequestMagicLink mails a login link to email if such an active user
+// exists, and returns the nonce the link is bound to. The caller hands the
+// nonce to the requesting browser only; the link works nowhere else. A nonce
+// comes back either way, and the link is made and mailed in the background,
+// so callers can probe for accounts neither by the answer nor by its timing.
+// Requests per address and per IP are limited by MailRequests.
+func (s *AuthService) RequestMagicLink(email string, client ClientInfo) (string, error) {
+	if !MagicLinksEnabled {
+		return "", ErrMagicLinksDisabled
+	}
+	if err := s.checkThrottle(throttleKeys(email, client)); err != nil {
+		return "", err
+	}
+	if err := s.takeMailRequest("magic_link", email, client); err != nil {
+		return "", err
+	}
+
+	nonce, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	sendInBackground("magic link", func() error {
+		return s.sendMagicLink(email, utils.HashToken(nonce), client)
+	})
+	return nonce, nil
+}
+
+// sendMagicLink stores a link bound to nonceHash and mails it to email, if
+// such an active user exists and wasn't sent one in the last
+// MailRequests.ResendAfter
+func (s *AuthService) sendMagicLink(email, nonceHash string, client ClientInfo) error {
+	var user model.User
+	if err := s.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.LockedAt != nil || user.DisabledAt != nil {
+		return nil
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	skip := false
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the user so concurrent requests can't both replace the link
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&model.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		// A link mailed moments ago keeps working; repeated requests mustn't
+		// kill it before its owner gets to open it
+		var recent int64
+		now := time.Now()
+		if err := tx.Model(&model.MagicLink{}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ? AND created_at > ?",
+				user.ID, now, now.Add(-MailRequests.ResendAfter)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			skip = true
+			return nil
+		}
+
+		// Only the most recent link works
+		if err := tx.Model(&model.MagicLink{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.MagicLink{
+			TokenHash: utils.HashToken(token),
+			UserID:    user.ID,
+			NonceHash: nonceHash,
+			ExpiresAt: time.Now().Add(MagicLinkTTL),
+		}).Error
+	})
+	if err != nil || skip {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action: "magic_link_requested",
+		Actor:  Actor{Client: client},
+		User:   &user,
+	})
+
+	if err := s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Someone asked to sign in to this account without a password.\n\n"+
+			"Open this link within %s, in the same browser you asked from:\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.",
+			MagicLinkTTL, fmt.Sprintf(MagicLinkURL, token)),
+	}); err != nil {
+		log.Printf("Failed to send magic link mail to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// LoginWithMagicLink redeems a login link opened in the browser holding
+// nonce and signs its user in like Login does, including the risk checks
+// and second factor. Links are single-use, except that opening one in
+// another browser doesn't use it up.
+func (s *AuthService) LoginWithMagicLink(token, nonce string, orgID uint, client ClientInfo) (*LoginResult, error) {
+	if !MagicLinksEnabled {
+		return nil, ErrMagicLinksDisabled
+	}
+	tokenHash := utils.HashToken(token)
+	var link model.MagicLink
+	if err := s.DB.First(&link, "token_hash = ?", tokenHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.recordFailures(throttleKeys("", client)[1:])
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	var user model.User
+	if err := s.DB.First(&user, link.UserID).Error; err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	keys := throttleKeys(user.Email, client)
+	if err := s.checkThrottle(keys); err != nil {
+		if _, ok := IsTooManyAttempts(err); ok {
+			s.auditLoginFailure(user.Email, &user, client, "throttled")
+		}
+		return nil, err
+	}
+
+	reason := ""
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&link, "token_hash = ?", tokenHash).Error; err != nil {
+			return err
+		}
+		if link.UsedAt != nil || time.Now().After(link.ExpiresAt) {
+			reason = "used_or_expired_link"
+			return ErrInvalidMagicLink
+		}
+		if nonce == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(nonce)), []byte(link.NonceHash)) != 1 {
+			reason = "wrong_browser"
+			return ErrInvalidMagicLink
+		}
+		return tx.Model(&link).Update("used_at", time.Now()).Error
+	})
+	if errors.Is(err, ErrInvalidMagicLink) {
+		s.recordFailures(keys)
+		s.auditLoginFailure(user.Email, &user, client, reason)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.LockedAt != nil || user.DisabledAt != nil {
+		reason := "locked"
+		if user.DisabledAt != nil {
+			reason = "disabled"
+		}
+		s.auditLoginFailure(user.Email, &user, client, reason)
+		return nil, ErrInvalidMagicLink
+	}
+
+	return s.finishLogin(&user, "magic_link", orgID, keys[0], client)
+}
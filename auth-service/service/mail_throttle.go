@@ -0,0 +1,99 @@
+package service
+
+import (
+	"auth-service/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MailRequestPolicy limits requests that make the service mail a link, so
+// nobody can flood an inbox or keep replacing someone's link
+type MailRequestPolicy struct {
+	PerEmail int           // requests for one address per Window
+	PerIP    int           // requests from one IP per Window
+	Window   time.Duration // counting restarts once this has passed
+	// ResendAfter is how old an unused link must be before a new request
+	// replaces it; sooner requests leave the mailed link working
+	ResendAfter time.Duration
+	// MaxPending caps the mails being prepared in the background; further
+	// requests wait for a free slot
+	MaxPending int
+}
+
+var MailRequests = MailRequestPolicy{
+	PerEmail:    5,
+	PerIP:       30,
+	Window:      15 * time.Minute,
+	ResendAfter: time.Minute,
+	MaxPending:  32,
+}
+
+var pendingMail = make(chan struct{}, MailRequests.MaxPending)
+
+// takeMailRequest counts a request of kind ("magic_link", "password_reset")
+// for email from client, and returns ErrTooManyAttempts once either has used
+// up its share of the window. The counters share the login_throttles table
+// under keys prefixed with kind; LastFailureAt is when the window began.
+func (s *AuthService) takeMailRequest(kind, email string, client ClientInfo) error {
+	keys := throttleKeys(email, client)
+	for i := range keys {
+		keys[i] = kind + ":" + keys[i]
+	}
+	if err := s.checkThrottle(keys); err != nil {
+		return err
+	}
+
+	limits := []int{MailRequests.PerEmail, MailRequests.PerIP}
+	for i, key := range keys {
+		if err := s.countMailRequest(key, limits[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countMailRequest bumps the counter of key and blocks it for the rest of the
+// window once it reaches limit
+func (s *AuthService) countMailRequest(key string, limit int) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginThrottle{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var t model.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&t).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if now.Sub(t.LastFailureAt) > MailRequests.Window {
+			t.Failures = 0
+			t.LastFailureAt = now
+			t.BlockedUntil = nil
+		}
+		t.Failures++
+		if t.Failures >= limit {
+			until := t.LastFailureAt.Add(MailRequests.Window)
+			t.BlockedUntil = &until
+		}
+		return tx.Save(&t).Error
+	})
+}
+
+// sendInBackground runs send on its own goroutine once one of the
+// MaxPending slots is free. The wait happens before send looks anything up,
+// so it tells callers nothing about the account.
+func sendInBackground(what string, send func() error) {
+	pendingMail <- struct{}{}
+	go func() {
+		defer func() { <-pendingMail }()
+		if err := send(); err != nil {
+			log.Printf("Failed to create %s: %v", what, err)
+		}
+	}()
+}
@@ -0,0 +1,442 @@
+package service
+
+import (
+	"auth-service/mailer"
+	"auth-service/model"
+	"auth-service/utils"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("mfa is already enabled")
+	ErrMFANotEnrolled      = errors.New("mfa enrollment has not been started")
+	ErrMFANotEnabled       = errors.New("mfa is not enabled")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+)
+
+var (
+	// MFAIssuer is the account label shown in authenticator apps
+	MFAIssuer = "Talent Management"
+	// MFAChallengeTTL is how long a user has to enter their code after the password
+	MFAChallengeTTL = 5 * time.Minute
+)
+
+const (
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+// MFAEnrollment is what a user scans into their authenticator app
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// LoginResult is either a token pair, or an MFA challenge to complete first
+type LoginResult struct {
+	Tokens    *TokenPair
+	MFAToken  string
+	MFAMethod string // how the second factor for MFAToken is entered
+}
+
+// Ways a second factor is entered
+const (
+	MFAMethodTOTP  = "totp"  // authenticator app or recovery code
+	MFAMethodEmail = "email" // one-time code mailed for a risky login
+)
+
+// EnrollMFA starts TOTP enrollment with a fresh secret. MFA only takes effect
+// once ActivateMFA confirms the user can produce codes.
+func (s *AuthService) EnrollMFA(userID uint) (*MFAEnrollment, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(user).Updates(map[string]interface{}{
+		"mfa_secret":    secret,
+		"mfa_last_step": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    utils.TOTPURI(MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ActivateMFA turns MFA on after checking a code from the enrolled secret,
+// and returns a first set of recovery codes. Wrong codes count like failed
+// logins.
+func (s *AuthService) ActivateMFA(userID uint, code string, client ClientInfo) ([]string, error) {
+	var codes []string
+	var user model.User
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.MFAEnabled {
+			return ErrMFAAlreadyEnabled
+		}
+		if user.MFASecret == "" {
+			return ErrMFANotEnrolled
+		}
+		if err := s.checkThrottle(throttleKeys(user.Email, client)); err != nil {
+			return err
+		}
+		if !acceptTOTP(tx, &user, code) {
+			return ErrInvalidMFACode
+		}
+		if err := tx.Model(&user).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	s.settleMFAAttempt(&user, client, err)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action: "mfa_enabled",
+		Actor:  actorFor(&user, client),
+		User:   &user,
+	})
+	return codes, nil
+}
+
+// DisableMFA turns MFA off; code may be a TOTP code or a recovery code.
+// Wrong codes count like failed logins.
+func (s *AuthService) DisableMFA(userID uint, code string, client ClientInfo) error {
+	var user model.User
+	var factor string
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if !user.MFAEnabled {
+			return ErrMFANotEnabled
+		}
+		if err := s.checkThrottle(throttleKeys(user.Email, client)); err != nil {
+			return err
+		}
+		var err error
+		if factor, err = verifySecondFactor(tx, &user, code); err != nil {
+			return err
+		}
+		if factor == "" {
+			return ErrInvalidMFACode
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"mfa_enabled":   false,
+			"mfa_secret":    "",
+			"mfa_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+	s.settleMFAAttempt(&user, client, err)
+	if err != nil {
+		return err
+	}
+	s.auditSecondFactor(&user, factor, client)
+
+	s.audit(AuditEvent{
+		Action: "mfa_disabled",
+		Actor:  actorFor(&user, client),
+		User:   &user,
+	})
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a TOTP
+// code. Wrong codes count like failed logins.
+func (s *AuthService) RegenerateRecoveryCodes(userID uint, code string, client ClientInfo) ([]string, error) {
+	var codes []string
+	var user model.User
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if !user.MFAEnabled {
+			return ErrMFANotEnabled
+		}
+		if err := s.checkThrottle(throttleKeys(user.Email, client)); err != nil {
+			return err
+		}
+		if !acceptTOTP(tx, &user, code) {
+			return ErrInvalidMFACode
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	s.settleMFAAttempt(&user, client, err)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action: "mfa_recovery_codes_regenerated",
+		Actor:  actorFor(&user, client),
+		User:   &user,
+	})
+	return codes, nil
+}
+
+// settleMFAAttempt counts a wrong code of a signed-in user against the same
+// keys and account as a wrong code at login, and forgets earlier failures
+// once a code checked out
+func (s *AuthService) settleMFAAttempt(user *model.User, client ClientInfo, err error) {
+	keys := throttleKeys(user.Email, client)
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		s.recordFailures(keys)
+		s.recordAccountFailure(user)
+	case err == nil:
+		s.clearFailures(user, keys[0])
+	}
+}
+
+// CompleteMFALogin exchanges an MFA challenge plus a TOTP or recovery code
+// for a token pair. Each challenge allows a handful of attempts.
+func (s *AuthService) CompleteMFALogin(challengeToken, code string, client ClientInfo) (*TokenPair, error) {
+	var user model.User
+	var ch model.MFAChallenge
+	var failed bool
+	var factor string
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(challengeToken)).
+			First(&ch).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidMFAChallenge
+			}
+			return err
+		}
+		if ch.UsedAt != nil || ch.Attempts >= maxMFAAttempts || time.Now().After(ch.ExpiresAt) {
+			return ErrInvalidMFAChallenge
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, ch.UserID).Error; err != nil ||
+			user.DisabledAt != nil || user.LockedAt != nil {
+			return ErrInvalidMFAChallenge
+		}
+		// Guesses across fresh challenges back off like password guesses
+		if err := s.checkThrottle(throttleKeys(user.Email, client)); err != nil {
+			return err
+		}
+
+		if ch.EmailCodeHash != "" {
+			if subtle.ConstantTimeCompare([]byte(utils.HashToken(strings.TrimSpace(code))), []byte(ch.EmailCodeHash)) == 1 {
+				factor = MFAMethodEmail
+			}
+		} else {
+			var err error
+			if factor, err = verifySecondFactor(tx, &user, code); err != nil {
+				return err
+			}
+		}
+		if factor == "" {
+			// Count the attempt and commit it, the caller still gets an error
+			failed = true
+			return tx.Model(&ch).Update("attempts", ch.Attempts+1).Error
+		}
+		return tx.Model(&ch).Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := throttleKeys(user.Email, client)
+	if failed {
+		s.recordFailures(keys)
+		s.recordAccountFailure(&user)
+		s.audit(AuditEvent{
+			Action:  "login_failed",
+			Outcome: OutcomeFailure,
+			Actor:   actorFor(&user, client),
+			User:    &user,
+			Details: map[string]interface{}{"reason": "wrong_mfa_code"},
+		})
+		return nil, ErrInvalidMFACode
+	}
+
+	s.clearFailures(&user, keys[0])
+	s.auditSecondFactor(&user, factor, client)
+
+	var orgID uint
+	if ch.OrgID != nil {
+		orgID = *ch.OrgID
+	}
+	pair, err := s.startSession(&user, orgID, client)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberLogin(user.ID, client)
+
+	s.audit(AuditEvent{
+		Action:  "login",
+		Actor:   actorFor(&user, client),
+		User:    &user,
+		Details: loginDetails(map[string]interface{}{"mfa": true}, orgID),
+	})
+	return pair, nil
+}
+
+// createMFAChallenge stores a challenge for user logging in to orgID and
+// returns its token. For MFAMethodEmail a one-time code is mailed to the
+// user as the second factor.
+func (s *AuthService) createMFAChallenge(user *model.User, orgID uint, method string) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	ch := model.MFAChallenge{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(MFAChallengeTTL),
+	}
+	if orgID != 0 {
+		ch.OrgID = &orgID
+	}
+	var code string
+	if method == MFAMethodEmail {
+		if code, err = emailCode(); err != nil {
+			return "", err
+		}
+		ch.EmailCodeHash = utils.HashToken(code)
+	}
+	if err := s.DB.Create(&ch).Error; err != nil {
+		return "", err
+	}
+
+	if code != "" {
+		if err := s.Mailer.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Your sign-in code",
+			Body: fmt.Sprintf("We need to make sure it's you signing in.\n\n"+
+				"Enter this code within %s to finish signing in: %s\n\n"+
+				"If you didn't just try to sign in, change your password right away.",
+				MFAChallengeTTL, code),
+		}); err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// emailCode is a random six-digit code
+func emailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// factorRecoveryCode is what verifySecondFactor reports for a recovery code
+const factorRecoveryCode = "recovery_code"
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code,
+// and reports which it was: MFAMethodTOTP, factorRecoveryCode, or "" when
+// the code is wrong
+func verifySecondFactor(tx *gorm.DB, user *model.User, code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if acceptTOTP(tx, user, code) {
+		return MFAMethodTOTP, nil
+	}
+
+	res := tx.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected > 0 {
+		return factorRecoveryCode, nil
+	}
+	return "", nil
+}
+
+// auditSecondFactor records that user spent a recovery code, once the
+// transaction that used it has committed. Audit entries are never written
+// inside another transaction, see appendAuditEntry.
+func (s *AuthService) auditSecondFactor(user *model.User, factor string, client ClientInfo) {
+	if factor != factorRecoveryCode {
+		return
+	}
+	s.audit(AuditEvent{
+		Action: "mfa_recovery_code_used",
+		Actor:  actorFor(user, client),
+		User:   user,
+	})
+}
+
+// acceptTOTP checks a TOTP code and burns its time step so it can't be replayed
+func acceptTOTP(tx *gorm.DB, user *model.User, code string) bool {
+	step, ok := utils.ValidateTOTP(user.MFASecret, code, time.Now())
+	if !ok || step <= user.MFALastStep {
+		return false
+	}
+	if err := tx.Model(user).Update("mfa_last_step", step).Error; err != nil {
+		return false
+	}
+	return true
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:12]
+		codes[i] = raw[:4] + "-" + raw[4:8] + "-" + raw[8:]
+		rows[i] = model.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(raw)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode drops the dashes and case users type codes with
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid client credentials")
+	ErrInvalidScope  = errors.New("requested scope is not allowed for this client")
+)
+
+// oauthClientIDPrefix starts every generated client_id
+const oauthClientIDPrefix = "client_"
+
+// TokenIntrospection describes a token as RFC 7662 reports it
+type TokenIntrospection struct {
+	Active    bool
+	TokenType string        // "access_token", "refresh_token" or "api_key"
+	Claims    *utils.Claims // set for access tokens and API keys
+	UserID    uint
+	Email     string
+	ExpiresAt time.Time
+}
+
+// CreateOAuthClient registers a client allowed to request tokens with up to
+// scopes. The secret is returned only here.
+func (s *AuthService) CreateOAuthClient(actor Actor, name string, scopes []string) (*model.OAuthClient, string, error) {
+	scopes = uniqueStrings(scopes)
+	if err := checkScopesHeld(actor, scopes); err != nil {
+		return nil, "", err
+	}
+	if _, err := findPermissions(s.DB, scopes); err != nil {
+		return nil, "", err
+	}
+	scopesJSON, err := encodeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := model.OAuthClient{
+		ClientID:    oauthClientIDPrefix + id[:16],
+		SecretHash:  utils.HashToken(secret),
+		Name:        name,
+		Scopes:      scopesJSON,
+		CreatedByID: actor.UserID,
+	}
+	if err := s.DB.Create(&client).Error; err != nil {
+		return nil, "", err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "oauth_client_created",
+		Actor:      actor,
+		TargetType: "oauth_client",
+		TargetID:   client.ClientID,
+		Details:    map[string]interface{}{"name": name, "scopes": scopes},
+	})
+	return &client, secret, nil
+}
+
+// ListOAuthClients returns every registered client
+func (s *AuthService) ListOAuthClients() ([]model.OAuthClient, error) {
+	var clients []model.OAuthClient
+	err := s.DB.Order("created_at DESC").Find(&clients).Error
+	return clients, err
+}
+
+// DeleteOAuthClient unregisters a client. Tokens it already holds stay valid
+// until they expire unless revoked.
+func (s *AuthService) DeleteOAuthClient(actor Actor, id uint) error {
+	var client model.OAuthClient
+	if err := s.DB.First(&client, id).Error; err != nil {
+		return err
+	}
+	if err := s.DB.Delete(&client).Error; err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "oauth_client_deleted",
+		Actor:      actor,
+		TargetType: "oauth_client",
+		TargetID:   client.ClientID,
+	})
+	return nil
+}
+
+// AuthenticateClient checks a client_id and secret
+func (s *AuthService) AuthenticateClient(clientID, secret string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	if err := s.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(utils.HashToken(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return &client, nil
+}
+
+// IssueClientToken implements the client_credentials grant. An empty
+// requested scope means every scope the client is allowed.
+func (s *AuthService) IssueClientToken(client *model.OAuthClient, requested []string, info ClientInfo) (string, []string, error) {
+	allowed := client.ScopeList()
+	scopes := allowed
+	if len(requested) > 0 {
+		granted := map[string]bool{}
+		for _, sc := range allowed {
+			granted[sc] = true
+		}
+		for _, sc := range requested {
+			if !granted[sc] {
+				return "", nil, ErrInvalidScope
+			}
+		}
+		scopes = uniqueStrings(requested)
+	}
+
+	jti, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := utils.GenerateJWT(utils.Claims{
+		Permissions: scopes,
+		ClientID:    client.ClientID,
+		Scope:       strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: client.ClientID,
+			ID:      jti,
+		},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "oauth_token_issued",
+		Actor:      Actor{Email: "client:" + client.ClientID, Client: info},
+		TargetType: "oauth_client",
+		TargetID:   client.ClientID,
+		Details:    map[string]interface{}{"scopes": scopes, "jti": jti},
+	})
+	return token, scopes, nil
+}
+
+// IntrospectToken reports whether token is active. Clients may only learn
+// about their own tokens unless they hold the tokens:introspect scope; any
+// other token is reported inactive, as RFC 7662 allows. Every token type is
+// tried, so no token_type_hint is needed.
+func (s *AuthService) IntrospectToken(client *model.OAuthClient, token string) (*TokenIntrospection, error) {
+	inactive := &TokenIntrospection{}
+	privileged := hasScope(client, "tokens:introspect")
+
+	if claims, err := utils.ValidateCredential(token); err == nil {
+		if !privileged && claims.ClientID != client.ClientID {
+			return inactive, nil
+		}
+		info := &TokenIntrospection{
+			Active:    true,
+			TokenType: "access_token",
+			Claims:    claims,
+			UserID:    claims.UserID,
+			Email:     claims.Email,
+		}
+		if utils.IsAPIKey(token) {
+			info.TokenType = "api_key"
+		}
+		if claims.ExpiresAt != nil {
+			info.ExpiresAt = claims.ExpiresAt.Time
+		}
+		return info, nil
+	}
+
+	// Refresh tokens belong to users, never to a client
+	if !privileged {
+		return inactive, nil
+	}
+	var rt model.RefreshToken
+	err := s.DB.Where("token_hash = ?", utils.HashToken(token)).First(&rt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return inactive, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
+		return inactive, nil
+	}
+	user, err := s.GetUser(rt.UserID)
+	if err != nil || user.DisabledAt != nil {
+		return inactive, nil
+	}
+	return &TokenIntrospection{
+		Active:    true,
+		TokenType: "refresh_token",
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: rt.ExpiresAt,
+	}, nil
+}
+
+// RevokeToken implements RFC 7009. Clients may revoke their own access
+// tokens; revoking anyone else's, or a refresh token, takes the
+// tokens:revoke scope. Unknown and foreign tokens are silently ignored.
+func (s *AuthService) RevokeToken(client *model.OAuthClient, token string, info ClientInfo) error {
+	privileged := hasScope(client, "tokens:revoke")
+	actor := Actor{Email: "client:" + client.ClientID, Client: info}
+
+	if claims, err := utils.ValidateJWT(token); err == nil {
+		if !privileged && claims.ClientID != client.ClientID {
+			return nil
+		}
+		return s.revokeAccessToken(actor, claims)
+	}
+
+	if !privileged {
+		return nil
+	}
+	var rt model.RefreshToken
+	err := s.DB.Where("token_hash = ?", utils.HashToken(token)).First(&rt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := revokeFamily(s.DB, rt.FamilyID, time.Now()); err != nil {
+		return err
+	}
+
+	user, _ := s.GetUser(rt.UserID)
+	s.audit(AuditEvent{
+		Action:  "token_revoked",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"token_type": "refresh_token", "session": rt.FamilyID},
+	})
+	return nil
+}
+
+// revokeAccessToken revokes the session an access token belongs to, or the
+// token alone when it has none
+func (s *AuthService) revokeAccessToken(actor Actor, claims *utils.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+
+	var session model.Session
+	err := s.DB.Where("id = ?", claims.ID).First(&session).Error
+	switch {
+	case err == nil:
+		if err := s.DB.Transaction(func(tx *gorm.DB) error {
+			return revokeFamily(tx, session.ID, time.Now())
+		}); err != nil {
+			return err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		now := time.Now()
+		revoked := model.RevokedToken{JTI: claims.ID, RevokedAt: now}
+		if claims.ExpiresAt != nil {
+			revoked.ExpiresAt = claims.ExpiresAt.Time
+		}
+		if err := s.DB.Save(&revoked).Error; err != nil {
+			return err
+		}
+		sessionStatus.add(now, claims.ID)
+	default:
+		return err
+	}
+
+	e := AuditEvent{
+		Action:  "token_revoked",
+		Actor:   actor,
+		Details: map[string]interface{}{"token_type": "access_token", "jti": claims.ID},
+	}
+	if claims.ClientID != "" {
+		e.TargetType = "oauth_client"
+		e.TargetID = claims.ClientID
+	} else {
+		e.User, _ = s.GetUser(claims.UserID)
+	}
+	s.audit(e)
+	return nil
+}
+
+func hasScope(client *model.OAuthClient, scope string) bool {
+	return utils.PermissionGranted(client.ScopeList(), scope)
+}
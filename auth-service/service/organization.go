@@ -0,0 +1,473 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownOrg  = errors.New("unknown organization")
+	ErrNotMember   = errors.New("not a member of this organization")
+	ErrOrgExists   = errors.New("an organization with this slug already exists")
+	ErrInvalidSlug = errors.New("slug must be lowercase letters, digits and dashes")
+	ErrOrgScoped   = errors.New("not allowed while acting in an organization")
+)
+
+// globalPermissions reach beyond any one organization: roles, invitations
+// and role grants are global, and so are the audit log, SCIM, service
+// accounts and OAuth clients. Roles held in an organization never grant
+// them; only roles held outside one do.
+var globalPermissions = []string{
+	"roles:write",
+	"invitations:write",
+	"audit:read",
+	"scim:write",
+	"service_accounts:write",
+	"oauth_clients:write",
+	"tokens:introspect",
+	"tokens:revoke",
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// CreateOrganization adds a tenant
+func (s *AuthService) CreateOrganization(actor Actor, slug, name string) (*model.Organization, error) {
+	if actor.OrgID != 0 {
+		return nil, ErrOrgScoped
+	}
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidSlug
+	}
+	if strings.TrimSpace(name) == "" {
+		name = slug
+	}
+
+	org := model.Organization{Slug: slug, Name: name}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Organization{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrgExists
+		}
+		return tx.Create(&org).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "org_created",
+		Actor:      actor,
+		TargetType: "org",
+		TargetID:   org.Slug,
+		Details:    map[string]interface{}{"name": org.Name},
+	})
+	return &org, nil
+}
+
+// ListOrganizations returns every organization by slug, only the one
+// actor acts in if any
+func (s *AuthService) ListOrganizations(actor Actor) ([]model.Organization, error) {
+	q := s.DB.Order("slug")
+	if actor.OrgID != 0 {
+		q = q.Where("id = ?", actor.OrgID)
+	}
+	var orgs []model.Organization
+	err := q.Find(&orgs).Error
+	return orgs, err
+}
+
+// GetOrganization loads an organization by ID
+func (s *AuthService) GetOrganization(id uint) (*model.Organization, error) {
+	var org model.Organization
+	if err := s.DB.First(&org, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownOrg
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+// DeleteOrganization removes an organization with its memberships and
+// signs out every session acting in it
+func (s *AuthService) DeleteOrganization(actor Actor, id uint) error {
+	if actor.OrgID != 0 {
+		return ErrOrgScoped
+	}
+	org, err := s.GetOrganization(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", org.ID).Delete(&model.Membership{}).Error; err != nil {
+			return err
+		}
+		if err := revokeOrgSessions(tx, org.ID, 0); err != nil {
+			return err
+		}
+		return tx.Delete(org).Error
+	})
+	if err != nil {
+		return err
+	}
+	memberships.forgetOrg(org.ID)
+
+	s.audit(AuditEvent{
+		Action:     "org_deleted",
+		Actor:      actor,
+		TargetType: "org",
+		TargetID:   org.Slug,
+	})
+	return nil
+}
+
+// OrgMember is a user with their roles in one organization
+type OrgMember struct {
+	Org   model.Organization
+	User  model.User
+	Roles []string
+}
+
+// ListOrgMembers returns the members of org id by email
+func (s *AuthService) ListOrgMembers(actor Actor, id uint) ([]OrgMember, error) {
+	org, err := s.adminOrg(actor, id)
+	if err != nil {
+		return nil, err
+	}
+	var rows []model.Membership
+	if err := s.DB.Where("org_id = ?", org.ID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return s.orgMembers(rows, map[uint]model.Organization{org.ID: *org})
+}
+
+// UserOrganizations returns the organizations userID belongs to, with their
+// roles in each
+func (s *AuthService) UserOrganizations(userID uint) ([]OrgMember, error) {
+	var rows []model.Membership
+	if err := s.DB.Where("user_id = ?", userID).Order("org_id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(rows))
+	for i, m := range rows {
+		ids[i] = m.OrgID
+	}
+	var orgs []model.Organization
+	if err := s.DB.Where("id IN ?", ids).Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]model.Organization{}
+	for _, o := range orgs {
+		byID[o.ID] = o
+	}
+	return s.orgMembers(rows, byID)
+}
+
+func (s *AuthService) orgMembers(rows []model.Membership, orgs map[uint]model.Organization) ([]OrgMember, error) {
+	ids := make([]uint, len(rows))
+	for i, m := range rows {
+		ids[i] = m.UserID
+	}
+	var users []model.User
+	if err := s.DB.Where("id IN ?", ids).Order("email").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byUser := map[uint]model.Membership{}
+	for _, m := range rows {
+		byUser[m.UserID] = m
+	}
+
+	out := make([]OrgMember, 0, len(rows))
+	for _, u := range users {
+		m := byUser[u.ID]
+		out = append(out, OrgMember{Org: orgs[m.OrgID], User: u, Roles: m.RoleList()})
+	}
+	return out, nil
+}
+
+// SetOrgMember adds userID to org id, or changes their roles there
+func (s *AuthService) SetOrgMember(actor Actor, orgID, userID uint, roles []string) (*OrgMember, error) {
+	if actor.UserID == userID {
+		return nil, ErrSelfAdminEdit
+	}
+	org, err := s.adminOrg(actor, orgID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	roles = uniqueStrings(roles)
+	if err := s.validateRoles(roles); err != nil {
+		return nil, err
+	}
+	stored := cleanRoles(roles)
+
+	var membership model.Membership
+	var oldRoles []string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("org_id = ? AND user_id = ?", org.ID, user.ID).First(&membership).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.checkGrantable(actor, roles); err != nil {
+				return err
+			}
+			membership = model.Membership{OrgID: org.ID, UserID: user.ID, Roles: stored}
+			return tx.Create(&membership).Error
+		case err != nil:
+			return err
+		}
+		oldRoles = membership.RoleList()
+		if err := s.checkGrantable(actor, addedRoles(oldRoles, roles)); err != nil {
+			return err
+		}
+		return tx.Model(&membership).Update("roles", stored).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	memberships.set(org.ID, user.ID, true)
+
+	s.audit(AuditEvent{
+		Action:  "org_member_updated",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"org": org.Slug, "old_roles": oldRoles, "new_roles": roles},
+	})
+	return &OrgMember{Org: *org, User: *user, Roles: roles}, nil
+}
+
+// RemoveOrgMember takes userID out of org id and signs out their sessions
+// acting in it
+func (s *AuthService) RemoveOrgMember(actor Actor, orgID, userID uint) error {
+	org, err := s.adminOrg(actor, orgID)
+	if err != nil {
+		return err
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("org_id = ? AND user_id = ?", org.ID, user.ID).Delete(&model.Membership{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotMember
+		}
+		return revokeOrgSessions(tx, org.ID, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	memberships.set(org.ID, user.ID, false)
+
+	s.audit(AuditEvent{
+		Action:  "org_member_removed",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"org": org.Slug, "tokens_revoked": true},
+	})
+	return nil
+}
+
+// SwitchOrg exchanges the session of claims for a new one acting in orgID,
+// or outside any organization when orgID is 0. The old session is signed
+// out, so its tokens stop working.
+func (s *AuthService) SwitchOrg(claims *utils.Claims, orgID uint, client ClientInfo) (*TokenPair, error) {
+	// A new session would be a real login as the impersonated user
+	if claims.Impersonated() {
+		return nil, ErrImpersonating
+	}
+	user, err := s.GetUser(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if orgID != 0 {
+		if _, err := findMembership(s.DB, orgID, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	var pair *TokenPair
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if claims.ID != "" {
+			if err := revokeFamily(tx, claims.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+		var err error
+		pair, err = s.startSessionTx(tx, user, orgID, client)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action: "org_switched",
+		Actor:  actorFor(user, client),
+		User:   user,
+		Details: map[string]interface{}{
+			"from_org": strconv.FormatUint(uint64(claims.OrgID), 10),
+			"to_org":   strconv.FormatUint(uint64(orgID), 10),
+		},
+	})
+	return pair, nil
+}
+
+// loginOrg picks the organization a new session acts in. An explicit
+// choice must be one the user belongs to. Without one, a user in exactly
+// one organization lands there and anyone else outside all of them.
+func loginOrg(tx *gorm.DB, userID, requested uint) (uint, error) {
+	if requested != 0 {
+		if _, err := findMembership(tx, requested, userID); err != nil {
+			return 0, err
+		}
+		return requested, nil
+	}
+	var orgIDs []uint
+	if err := tx.Model(&model.Membership{}).Where("user_id = ?", userID).Limit(2).Pluck("org_id", &orgIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(orgIDs) == 1 {
+		return orgIDs[0], nil
+	}
+	return 0, nil
+}
+
+// adminOrg loads org id for an admin action by actor, who acting in an
+// organization only reaches that one
+func (s *AuthService) adminOrg(actor Actor, id uint) (*model.Organization, error) {
+	if actor.OrgID != 0 && actor.OrgID != id {
+		return nil, ErrUnknownOrg
+	}
+	return s.GetOrganization(id)
+}
+
+// orgPermissions narrows perms, resolved from roles held in an
+// organization, to those that stay within it. Wildcards are spelled out
+// first, so "*" held in an organization doesn't grant globalPermissions.
+func orgPermissions(tx *gorm.DB, perms []string) ([]string, error) {
+	var known []string
+	if err := tx.Model(&model.Permission{}).Order("name").Pluck("name", &known).Error; err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, p := range known {
+		if strings.HasSuffix(p, "*") || containsString(globalPermissions, p) {
+			continue
+		}
+		if utils.PermissionGranted(perms, p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func findMembership(tx *gorm.DB, orgID, userID uint) (*model.Membership, error) {
+	var m model.Membership
+	if err := tx.Where("org_id = ? AND user_id = ?", orgID, userID).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotMember
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// revokeOrgSessions signs out the sessions acting in orgID, only those of
+// userID unless it is 0
+func revokeOrgSessions(tx *gorm.DB, orgID, userID uint) error {
+	q := tx.Model(&model.Session{}).Where("org_id = ? AND revoked_at IS NULL", orgID)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var ids []string
+	if err := q.Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		if err := revokeFamily(tx, id, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckTokenOrg is a utils.TokenCheck rejecting tokens for an organization
+// the user was removed from after the token was issued
+func (s *AuthService) CheckTokenOrg(claims *utils.Claims) error {
+	if claims.OrgID == 0 {
+		return nil
+	}
+	member, ok := memberships.get(claims.OrgID, claims.UserID)
+	if !ok {
+		_, err := findMembership(s.DB, claims.OrgID, claims.UserID)
+		switch {
+		case errors.Is(err, ErrNotMember):
+			member = false
+		case err != nil:
+			return err
+		default:
+			member = true
+		}
+		memberships.set(claims.OrgID, claims.UserID, member)
+	}
+	if !member {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// membershipCache remembers for UserStatusCacheTTL whether a user belongs
+// to an organization
+type membershipCache struct {
+	mu      sync.Mutex
+	entries map[[2]uint]userStatusEntry
+}
+
+var memberships = &membershipCache{entries: map[[2]uint]userStatusEntry{}}
+
+func (c *membershipCache) get(orgID, userID uint) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[[2]uint{orgID, userID}]
+	if !ok || time.Since(e.checkedAt) > UserStatusCacheTTL {
+		return false, false
+	}
+	return e.active, true
+}
+
+func (c *membershipCache) set(orgID, userID uint, member bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[[2]uint{orgID, userID}] = userStatusEntry{active: member, checkedAt: time.Now()}
+}
+
+func (c *membershipCache) forgetOrg(orgID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if k[0] == orgID {
+			c.entries[k] = userStatusEntry{active: false, checkedAt: time.Now()}
+		}
+	}
+}
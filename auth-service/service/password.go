@@ -0,0 +1,275 @@
+package service
+
+import (
+	"auth-service/mailer"
+	"auth-service/model"
+	"auth-service/passhash"
+	"auth-service/passpolicy"
+	"auth-service/utils"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+)
+
+var (
+	// Passwords hashes new passwords with argon2id and still accepts the
+	// bcrypt hashes of earlier versions, upgrading them at the next login
+	Passwords = &passhash.Policy{
+		Current: passhash.DefaultArgon2id,
+		Legacy:  []passhash.Hasher{passhash.Bcrypt{}},
+	}
+
+	// PasswordPolicy is what every new password is checked against
+	PasswordPolicy = passpolicy.Default
+
+	// PasswordResetTTL is how long a mailed reset link stays usable
+	PasswordResetTTL = 30 * time.Minute
+	// PasswordResetURL is the link mailed to users; %s is replaced with the token
+	PasswordResetURL = "http://localhost:3000/reset-password?token=%s"
+)
+
+// ChangePassword replaces the password of userID after checking the current
+// one, and signs the user out everywhere. Wrong current passwords count
+// toward the same backoff and lockout as failed logins, so a stolen access
+// token can't be used to guess the password.
+func (s *AuthService) ChangePassword(userID uint, currentPassword, newPassword string, client ClientInfo) error {
+	var user model.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		return ErrInvalidCredentials
+	}
+
+	keys := throttleKeys(user.Email, client)
+	if err := s.checkThrottle(keys); err != nil {
+		return err
+	}
+	if ok, _, err := Passwords.Verify(user.HashedPassword, currentPassword); err != nil || !ok {
+		s.recordFailures(keys)
+		s.recordAccountFailure(&user)
+		s.audit(AuditEvent{
+			Action:  "password_change",
+			Outcome: OutcomeFailure,
+			Actor:   actorFor(&user, client),
+			User:    &user,
+			Details: map[string]interface{}{"reason": "wrong_password"},
+		})
+		return ErrInvalidCredentials
+	}
+
+	if err := checkPassword(newPassword, &user); err != nil {
+		s.audit(AuditEvent{
+			Action:  "password_change",
+			Outcome: OutcomeFailure,
+			Actor:   actorFor(&user, client),
+			User:    &user,
+			Details: map[string]interface{}{"reason": "password_policy", "rules": rejectedRules(err)},
+		})
+		return err
+	}
+
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return setPassword(tx, user.ID, newPassword)
+	}); err != nil {
+		return err
+	}
+	s.clearThrottle(keys[0])
+	if user.FailedLogins > 0 {
+		s.DB.Model(&user).Update("failed_logins", 0)
+	}
+
+	s.audit(AuditEvent{
+		Action:  "password_change",
+		Actor:   actorFor(&user, client),
+		User:    &user,
+		Details: map[string]interface{}{"tokens_revoked": true},
+	})
+	return nil
+}
+
+// RequestPasswordReset mails a reset link to email if such a user exists.
+// It reports success either way, and the link is made and mailed in the
+// background, so callers can probe for accounts neither by the answer nor by
+// its timing. Requests per address and per IP are limited by MailRequests.
+func (s *AuthService) RequestPasswordReset(email string, client ClientInfo) error {
+	if err := s.takeMailRequest("password_reset", email, client); err != nil {
+		return err
+	}
+	sendInBackground("password reset link", func() error {
+		return s.sendPasswordReset(email, client)
+	})
+	return nil
+}
+
+// sendPasswordReset stores a reset token and mails its link to email, if
+// such a user exists and wasn't sent one in the last MailRequests.ResendAfter
+func (s *AuthService) sendPasswordReset(email string, client ClientInfo) error {
+	var user model.User
+	if err := s.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	skip := false
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the user so concurrent requests can't both replace the link
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&model.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		// A link mailed moments ago keeps working
+		var recent int64
+		now := time.Now()
+		if err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ? AND created_at > ?",
+				user.ID, now, now.Add(-MailRequests.ResendAfter)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			skip = true
+			return nil
+		}
+
+		// Only the most recent link works
+		if err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(PasswordResetTTL),
+		}).Error
+	})
+	if err != nil || skip {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action: "password_reset_requested",
+		Actor:  Actor{Client: client},
+		User:   &user,
+	})
+
+	if err := s.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account.\n\n"+
+			"Use this link within %s to choose a new one:\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.",
+			PasswordResetTTL, fmt.Sprintf(PasswordResetURL, token)),
+	}); err != nil {
+		log.Printf("Failed to send password reset mail to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// ResetPassword redeems a reset token, sets the new password and signs the
+// user out everywhere
+func (s *AuthService) ResetPassword(token, newPassword string, client ClientInfo) error {
+	var user model.User
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var rt model.PasswordResetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(token)).
+			First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if rt.UsedAt != nil || time.Now().After(rt.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		if err := tx.Model(&rt).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&user, rt.UserID).Error; err != nil {
+			return ErrInvalidResetToken
+		}
+		// Rolling back leaves the token usable for a better password
+		if err := checkPassword(newPassword, &user); err != nil {
+			return err
+		}
+		return setPassword(tx, user.ID, newPassword)
+	})
+	if _, ok := IsPasswordRejected(err); ok {
+		s.audit(AuditEvent{
+			Action:  "password_reset",
+			Outcome: OutcomeFailure,
+			Actor:   actorFor(&user, client),
+			User:    &user,
+			Details: map[string]interface{}{"reason": "password_policy", "rules": rejectedRules(err)},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:  "password_reset",
+		Actor:   actorFor(&user, client),
+		User:    &user,
+		Details: map[string]interface{}{"tokens_revoked": true},
+	})
+	return nil
+}
+
+// setPassword stores a new password hash and revokes the user's refresh tokens
+func setPassword(tx *gorm.DB, userID uint, password string) error {
+	hashed, err := Passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&model.User{}).Where("id = ?", userID).
+		Update("hashed_password", hashed).Error; err != nil {
+		return err
+	}
+	return revokeUserTokens(tx, userID, time.Now())
+}
+
+// checkPassword applies PasswordPolicy to a new password of user
+func checkPassword(password string, user *model.User) error {
+	return PasswordPolicy.Check(password, passpolicy.Context{
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	})
+}
+
+// IsPasswordRejected returns the rules a password failed when err is a
+// policy violation
+func IsPasswordRejected(err error) ([]passpolicy.Violation, bool) {
+	var e *passpolicy.Error
+	if errors.As(err, &e) {
+		return e.Violations, true
+	}
+	return nil, false
+}
+
+func rejectedRules(err error) []string {
+	violations, _ := IsPasswordRejected(err)
+	rules := make([]string, len(violations))
+	for i, v := range violations {
+		rules[i] = v.Rule
+	}
+	return rules
+}
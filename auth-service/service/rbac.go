@@ -0,0 +1,391 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrRoleInUse         = errors.New("role is still assigned to users")
+	ErrRoleNotGrantable  = errors.New("cannot grant a role with permissions you don't hold")
+)
+
+// defaultPermissions are created on first start
+var defaultPermissions = map[string]string{
+	"*":                      "Everything",
+	"admin:access":           "Open the admin dashboard",
+	"users:read":             "List and view users",
+	"users:write":            "Change, disable and delete users",
+	"invitations:write":      "Invite new users",
+	"roles:write":            "Manage roles and permissions",
+	"hr:access":              "Open the HR panel",
+	"employees:read":         "View employee profiles and skills",
+	"employees:write":        "Edit employee profiles and skills",
+	"recruitment:read":       "View candidates and job postings",
+	"recruitment:write":      "Manage candidates and job postings",
+	"budgets:read":           "View budgets and forecasts",
+	"budgets:write":          "Edit budgets",
+	"teams:analyze":          "Run team and skill analysis",
+	"reports:read":           "View manager reports",
+	"audit:read":             "Search and export the audit log",
+	"service_accounts:write": "Manage service accounts and their API keys",
+	"oauth_clients:write":    "Manage OAuth clients",
+	"tokens:introspect":      "Introspect tokens issued to anyone (OAuth clients)",
+	"tokens:revoke":          "Revoke tokens issued to anyone (OAuth clients)",
+	"scim:write":             "Provision users and groups over SCIM",
+	"orgs:write":             "Manage organizations and their members",
+}
+
+// defaultRoles are created on first start, matching the roles that used to
+// be hardcoded in the route table
+var defaultRoles = map[string][]string{
+	"Admin":   {"*"},
+	"HR":      {"hr:access", "employees:read", "employees:write", "recruitment:read", "recruitment:write"},
+	"Manager": {"reports:read", "employees:read", "budgets:read", "teams:analyze"},
+}
+
+// SeedRBAC creates the default permissions, and the default roles if no
+// roles exist yet. Roles edited through the API are never overwritten.
+func (s *AuthService) SeedRBAC() error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for name, desc := range defaultPermissions {
+			if err := tx.Where(model.Permission{Name: name}).
+				Attrs(model.Permission{Description: desc}).
+				FirstOrCreate(&model.Permission{}).Error; err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&model.Role{}).Count(&count).Error; err != nil || count > 0 {
+			return err
+		}
+		for name, perms := range defaultRoles {
+			role := model.Role{Name: name}
+			if err := tx.Where("name IN ?", perms).Find(&role.Permissions).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ResolvePermissions returns the union of the permissions of roles
+func (s *AuthService) ResolvePermissions(roles []string) ([]string, error) {
+	perms := []string{}
+	if len(roles) == 0 {
+		return perms, nil
+	}
+	err := s.DB.Table("permissions").
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name IN ?", roles).
+		Order("permissions.name").
+		Pluck("permissions.name", &perms).Error
+	return perms, err
+}
+
+// ListRoles returns every role with its permissions
+func (s *AuthService) ListRoles() ([]model.Role, error) {
+	var roles []model.Role
+	err := s.DB.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// CreateRole adds a role granting permissions
+func (s *AuthService) CreateRole(actor Actor, name, description string, permissions []string) (*model.Role, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("role name is required")
+	}
+
+	if err := checkPermissionsHeld(actor, permissions); err != nil {
+		return nil, err
+	}
+
+	role := model.Role{Name: name, Description: description}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		perms, err := findPermissions(tx, permissions)
+		if err != nil {
+			return err
+		}
+		role.Permissions = perms
+		return tx.Create(&role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "role_created",
+		Actor:      actor,
+		TargetType: "role",
+		TargetID:   role.Name,
+		Details:    map[string]interface{}{"permissions": permissionNames(role.Permissions)},
+	})
+	return &role, nil
+}
+
+// UpdateRole replaces the description and permissions of a role
+func (s *AuthService) UpdateRole(actor Actor, name, description string, permissions []string) (*model.Role, error) {
+	var role model.Role
+	var oldPermissions []string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUnknownRole
+			}
+			return err
+		}
+		oldPermissions = permissionNames(role.Permissions)
+		if err := checkRoleEditable(actor, oldPermissions); err != nil {
+			return err
+		}
+		if err := checkPermissionsHeld(actor, addedRoles(oldPermissions, permissions)); err != nil {
+			return err
+		}
+		perms, err := findPermissions(tx, permissions)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Update("description", description).Error; err != nil {
+			return err
+		}
+		role.Description = description
+		return tx.Model(&role).Association("Permissions").Replace(perms)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "role_updated",
+		Actor:      actor,
+		TargetType: "role",
+		TargetID:   role.Name,
+		Details: map[string]interface{}{
+			"old_permissions": oldPermissions,
+			"new_permissions": permissionNames(role.Permissions),
+		},
+	})
+	return &role, nil
+}
+
+// DeleteRole removes a role that no user holds any more
+func (s *AuthService) DeleteRole(actor Actor, name string) error {
+	var role model.Role
+	if err := s.DB.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownRole
+		}
+		return err
+	}
+	if err := checkRoleEditable(actor, permissionNames(role.Permissions)); err != nil {
+		return err
+	}
+
+	holders, err := s.countUsersWithRole(name)
+	if err != nil {
+		return err
+	}
+	if holders > 0 {
+		return ErrRoleInUse
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		// Grants of the role would otherwise come back with a new role of the same name
+		if err := tx.Model(&model.RoleGrant{}).
+			Where("role = ? AND status IN ?", name, []string{model.GrantPending, model.GrantActive}).
+			Updates(map[string]interface{}{"status": model.GrantRevoked, "revoked_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "role_deleted",
+		Actor:      actor,
+		TargetType: "role",
+		TargetID:   role.Name,
+	})
+	return nil
+}
+
+// ListPermissions returns every known permission
+func (s *AuthService) ListPermissions() ([]model.Permission, error) {
+	var perms []model.Permission
+	err := s.DB.Order("name").Find(&perms).Error
+	return perms, err
+}
+
+// CreatePermission registers a new permission name, e.g. for a new service
+func (s *AuthService) CreatePermission(actor Actor, name, description string) (*model.Permission, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("permission name is required")
+	}
+	perm := model.Permission{Name: name, Description: description}
+	if err := s.DB.Create(&perm).Error; err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "permission_created",
+		Actor:      actor,
+		TargetType: "permission",
+		TargetID:   perm.Name,
+	})
+	return &perm, nil
+}
+
+// DeletePermission removes a permission from every role and deletes it
+func (s *AuthService) DeletePermission(actor Actor, name string) error {
+	var perm model.Permission
+	if err := s.DB.Where("name = ?", name).First(&perm).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownPermission
+		}
+		return err
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", perm.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&perm).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "permission_deleted",
+		Actor:      actor,
+		TargetType: "permission",
+		TargetID:   perm.Name,
+	})
+	return nil
+}
+
+// validateRoles makes sure every role name exists
+func (s *AuthService) validateRoles(roles []string) error {
+	for _, name := range roles {
+		var count int64
+		if err := s.DB.Model(&model.Role{}).Where("name = ?", strings.TrimSpace(name)).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, name)
+		}
+	}
+	return nil
+}
+
+// checkGrantable returns ErrRoleNotGrantable unless actor holds every
+// permission roles carry, so nobody hands out more than they have
+func (s *AuthService) checkGrantable(actor Actor, roles []string) error {
+	perms, err := s.ResolvePermissions(roles)
+	if err != nil {
+		return err
+	}
+	return checkPermissionsHeld(actor, perms)
+}
+
+// checkPermissionsHeld returns ErrRoleNotGrantable unless actor holds every
+// permission in perms, which are being added to a role
+func checkPermissionsHeld(actor Actor, perms []string) error {
+	for _, p := range perms {
+		if !utils.PermissionGranted(actor.Permissions, p) {
+			return fmt.Errorf("%w: %s", ErrRoleNotGrantable, p)
+		}
+	}
+	return nil
+}
+
+// checkRoleEditable refuses changes to a role granting "*", such as Admin,
+// unless actor holds "*" too
+func checkRoleEditable(actor Actor, perms []string) error {
+	if containsString(perms, "*") && !utils.PermissionGranted(actor.Permissions, "*") {
+		return fmt.Errorf("%w: *", ErrRoleNotGrantable)
+	}
+	return nil
+}
+
+// addedRoles returns the roles in next that aren't in prev
+func addedRoles(prev, next []string) []string {
+	var added []string
+	for _, r := range next {
+		if !containsString(prev, r) {
+			added = append(added, r)
+		}
+	}
+	return added
+}
+
+// countUsersWithRole counts the users holding role, directly or in an
+// organization
+func (s *AuthService) countUsersWithRole(role string) (int64, error) {
+	var users, members int64
+	if err := s.DB.Model(&model.User{}).
+		Where("roles @> ARRAY[?]::text[]", role).
+		Count(&users).Error; err != nil {
+		return 0, err
+	}
+	err := s.DB.Model(&model.Membership{}).
+		Where("roles @> ARRAY[?]::text[]", role).
+		Count(&members).Error
+	return users + members, err
+}
+
+// findPermissions loads permissions by name, failing on any unknown name
+func findPermissions(tx *gorm.DB, names []string) ([]model.Permission, error) {
+	perms := []model.Permission{}
+	if len(names) == 0 {
+		return perms, nil
+	}
+	if err := tx.Where("name IN ?", names).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	if len(perms) != len(uniqueStrings(names)) {
+		return nil, ErrUnknownPermission
+	}
+	return perms, nil
+}
+
+func permissionNames(perms []model.Permission) []string {
+	names := make([]string, len(perms))
+	for i, p := range perms {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func uniqueStrings(in []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"auth-service/model"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnknownGrant     = errors.New("unknown role grant")
+	ErrGrantNotPending  = errors.New("role request was already decided")
+	ErrGrantNotActive   = errors.New("role grant is not active")
+	ErrSelfApproval     = errors.New("role requests must be approved by someone else")
+	ErrNotApprover      = errors.New("only an Admin can approve role requests")
+	ErrInvalidGrant     = errors.New("invalid role grant")
+	ErrDuplicateRequest = errors.New("a request for this role is already pending")
+)
+
+var (
+	// MaxGrantDuration caps how long a time-bound role grant can last
+	MaxGrantDuration = 8 * time.Hour
+	// GrantApproverRole is the role whose holders approve role requests
+	GrantApproverRole = "Admin"
+)
+
+// sweeperActor is recorded in the audit log for grants that ran out
+var sweeperActor = Actor{Email: "system:role-grant-sweeper"}
+
+// GrantRequest describes a time-bound role a user needs
+type GrantRequest struct {
+	Role     string
+	Reason   string
+	Duration time.Duration
+}
+
+// RequestRoleGrant files a request by the actor for a role for a while. It
+// does nothing until another Admin approves it.
+func (s *AuthService) RequestRoleGrant(actor Actor, req GrantRequest) (*model.RoleGrant, error) {
+	user, err := s.GetUser(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantRequest(user, req); err != nil {
+		return nil, err
+	}
+
+	grant := model.RoleGrant{
+		UserID:        user.ID,
+		Role:          req.Role,
+		Reason:        req.Reason,
+		Status:        model.GrantPending,
+		Duration:      int64(req.Duration.Seconds()),
+		RequestedByID: actor.UserID,
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		if err := tx.Model(&model.RoleGrant{}).
+			Where("user_id = ? AND role = ? AND status = ?", user.ID, req.Role, model.GrantPending).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrDuplicateRequest
+		}
+		return tx.Create(&grant).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditGrant("role_grant_requested", actor, user, &grant)
+	return &grant, nil
+}
+
+// GrantRole gives userID a role until the duration runs out, without a
+// request
+func (s *AuthService) GrantRole(actor Actor, userID uint, req GrantRequest) (*model.RoleGrant, error) {
+	if actor.UserID == userID {
+		return nil, ErrSelfAdminEdit
+	}
+	if actor.OrgID != 0 {
+		return nil, ErrOrgScoped
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantRequest(user, req); err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantable(actor, []string{req.Role}); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expires := now.Add(req.Duration)
+	grant := model.RoleGrant{
+		UserID:        user.ID,
+		Role:          req.Role,
+		Reason:        req.Reason,
+		Status:        model.GrantActive,
+		Duration:      int64(req.Duration.Seconds()),
+		RequestedByID: actor.UserID,
+		DecidedByID:   &actor.UserID,
+		DecidedAt:     &now,
+		ExpiresAt:     &expires,
+	}
+	if err := s.DB.Create(&grant).Error; err != nil {
+		return nil, err
+	}
+
+	s.auditGrant("role_granted", actor, user, &grant)
+	return &grant, nil
+}
+
+func (s *AuthService) checkGrantRequest(user *model.User, req GrantRequest) error {
+	if strings.TrimSpace(req.Reason) == "" {
+		return fmt.Errorf("%w: a reason is required", ErrInvalidGrant)
+	}
+	if req.Duration <= 0 || req.Duration > MaxGrantDuration {
+		return fmt.Errorf("%w: duration must be between 1s and %s", ErrInvalidGrant, MaxGrantDuration)
+	}
+	if err := s.validateRoles([]string{req.Role}); err != nil {
+		return err
+	}
+	if containsString(user.RoleList(), req.Role) {
+		return fmt.Errorf("%w: user already has %s", ErrInvalidGrant, req.Role)
+	}
+	return nil
+}
+
+// ApproveRoleGrant starts a pending request. The approver must be an Admin
+// other than the requester; the grant runs for its duration from now.
+func (s *AuthService) ApproveRoleGrant(actor Actor, id uint) (*model.RoleGrant, error) {
+	return s.decideRoleGrant(actor, id, true)
+}
+
+// DenyRoleGrant turns a pending request down
+func (s *AuthService) DenyRoleGrant(actor Actor, id uint) (*model.RoleGrant, error) {
+	return s.decideRoleGrant(actor, id, false)
+}
+
+func (s *AuthService) decideRoleGrant(actor Actor, id uint, approve bool) (*model.RoleGrant, error) {
+	if actor.OrgID != 0 {
+		return nil, ErrOrgScoped
+	}
+	approver, err := s.GetUser(actor.UserID)
+	if err != nil || !containsString(approver.RoleList(), GrantApproverRole) {
+		return nil, ErrNotApprover
+	}
+
+	var grant model.RoleGrant
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&grant, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUnknownGrant
+			}
+			return err
+		}
+		if grant.Status != model.GrantPending {
+			return ErrGrantNotPending
+		}
+		if grant.UserID == actor.UserID || grant.RequestedByID == actor.UserID {
+			return ErrSelfApproval
+		}
+		if approve {
+			if err := s.checkGrantable(actor, []string{grant.Role}); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		grant.Status = model.GrantDenied
+		grant.DecidedByID = &actor.UserID
+		grant.DecidedAt = &now
+		if approve {
+			expires := now.Add(time.Duration(grant.Duration) * time.Second)
+			grant.Status = model.GrantActive
+			grant.ExpiresAt = &expires
+		}
+		return tx.Model(&grant).Select("status", "decided_by_id", "decided_at", "expires_at").Updates(&grant).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	action := "role_grant_denied"
+	if approve {
+		action = "role_grant_approved"
+	}
+	s.auditGrant(action, actor, s.grantUser(grant.UserID), &grant)
+	return &grant, nil
+}
+
+// RevokeRoleGrant ends an active grant early, or withdraws a pending
+// request. Tokens already issued keep the role until they expire, which
+// is never later than the grant would have.
+func (s *AuthService) RevokeRoleGrant(actor Actor, id uint) (*model.RoleGrant, error) {
+	if actor.OrgID != 0 {
+		return nil, ErrOrgScoped
+	}
+	var grant model.RoleGrant
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&grant, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUnknownGrant
+			}
+			return err
+		}
+		if grant.Status != model.GrantActive && grant.Status != model.GrantPending {
+			return ErrGrantNotActive
+		}
+		now := time.Now()
+		grant.Status = model.GrantRevoked
+		grant.RevokedAt = &now
+		return tx.Model(&grant).Select("status", "revoked_at").Updates(&grant).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditGrant("role_grant_revoked", actor, s.grantUser(grant.UserID), &grant)
+	return &grant, nil
+}
+
+// ListRoleGrants returns grants, newest first, optionally only those of
+// userID or in status. Acting in an organization, actor only sees their own.
+func (s *AuthService) ListRoleGrants(actor Actor, userID uint, status string) ([]model.RoleGrant, error) {
+	if actor.OrgID != 0 && userID != actor.UserID {
+		return nil, ErrOrgScoped
+	}
+	q := s.DB.Order("created_at DESC")
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var grants []model.RoleGrant
+	err := q.Find(&grants).Error
+	return grants, err
+}
+
+// activeGrants returns the grants of userID in force right now
+func activeGrants(tx *gorm.DB, userID uint, now time.Time) ([]model.RoleGrant, error) {
+	var grants []model.RoleGrant
+	err := tx.Where("user_id = ? AND status = ? AND expires_at > ?", userID, model.GrantActive, now).
+		Find(&grants).Error
+	return grants, err
+}
+
+// SweepExpiredGrants marks active grants whose time ran out as expired and
+// audits each. Tokens never outlive a grant, so this only tidies up the
+// record; the role is already gone from new tokens.
+func (s *AuthService) SweepExpiredGrants() error {
+	var expired []model.RoleGrant
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND expires_at <= ?", model.GrantActive, time.Now()).
+			Find(&expired).Error; err != nil {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(expired))
+		for i, g := range expired {
+			ids[i] = g.ID
+		}
+		return tx.Model(&model.RoleGrant{}).Where("id IN ?", ids).
+			Update("status", model.GrantExpired).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range expired {
+		expired[i].Status = model.GrantExpired
+		s.auditGrant("role_grant_expired", sweeperActor, s.grantUser(expired[i].UserID), &expired[i])
+	}
+	return nil
+}
+
+// StartGrantSweeper runs SweepExpiredGrants every interval in the background
+func (s *AuthService) StartGrantSweeper(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := s.SweepExpiredGrants(); err != nil {
+				log.Printf("Failed to sweep expired role grants: %v", err)
+			}
+		}
+	}()
+}
+
+// grantUser loads the user a grant is for, for the audit log
+func (s *AuthService) grantUser(id uint) *model.User {
+	var user model.User
+	if err := s.DB.Select("id", "email").First(&user, id).Error; err != nil {
+		user.ID = id
+	}
+	return &user
+}
+
+func (s *AuthService) auditGrant(action string, actor Actor, user *model.User, grant *model.RoleGrant) {
+	details := map[string]interface{}{
+		"grant":    strconv.FormatUint(uint64(grant.ID), 10),
+		"role":     grant.Role,
+		"reason":   grant.Reason,
+		"duration": (time.Duration(grant.Duration) * time.Second).String(),
+	}
+	if grant.ExpiresAt != nil {
+		details["expires_at"] = grant.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	s.audit(AuditEvent{
+		Action:  action,
+		Actor:   actor,
+		User:    user,
+		Details: details,
+	})
+}
@@ -0,0 +1,631 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailTaken      = errors.New("a user with this email already exists")
+	ErrExternalIDTaken = errors.New("another user already has this externalId")
+	ErrRoleExists      = errors.New("a role with this name already exists")
+	ErrPrivilegedUser  = errors.New("users holding privileged roles are managed through the admin API only")
+)
+
+// scimIssuer is the ExternalIdentity issuer holding the externalId a SCIM
+// client gave a user
+const scimIssuer = "scim"
+
+// privilegedPermissions make a role administrative. Such roles stay off the
+// SCIM surface: identity providers provision ordinary groups, admins are
+// only made through the admin API. Their holders can't be impersonated.
+var privilegedPermissions = []string{
+	"users:write",
+	"roles:write",
+	"orgs:write",
+	"scim:write",
+	"service_accounts:write",
+	"oauth_clients:write",
+	"tokens:revoke",
+}
+
+// SCIMUser is what a SCIM client manages of a user
+type SCIMUser struct {
+	Email      string
+	ExternalID string
+	FirstName  string
+	LastName   string
+	Active     bool
+	Password   string // optional, kept when empty
+}
+
+// SCIMPage is one page of a SCIM list; Offset counts from 0
+type SCIMPage struct {
+	Filter string
+	Offset int
+	Limit  int
+}
+
+// ListSCIMUsers returns the users matching a SCIM filter, and their total
+func (s *AuthService) ListSCIMUsers(page SCIMPage) ([]model.User, int64, error) {
+	q := s.DB.Model(&model.User{})
+	if page.Filter != "" {
+		cond, args, err := scimFilterSQL(page.Filter, scimUserAttrs)
+		if err != nil {
+			return nil, 0, err
+		}
+		q = q.Where(cond, args...)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []model.User
+	if page.Limit > 0 {
+		if err := q.Order("id").Offset(page.Offset).Limit(page.Limit).Find(&users).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	return users, total, nil
+}
+
+// SCIMExternalIDs returns the externalId of each of users that has one
+func (s *AuthService) SCIMExternalIDs(users []model.User) (map[uint]string, error) {
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	out := map[uint]string{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var links []model.ExternalIdentity
+	if err := s.DB.Where("issuer = ? AND user_id IN ?", scimIssuer, ids).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		out[l.UserID] = l.Subject
+	}
+	return out, nil
+}
+
+// CreateSCIMUser provisions a user. Without a password they can only sign
+// in through single sign-on or a directory until they reset it.
+func (s *AuthService) CreateSCIMUser(actor Actor, in SCIMUser) (*model.User, error) {
+	in.Email = strings.TrimSpace(in.Email)
+	if in.Email == "" {
+		return nil, errors.New("userName is required")
+	}
+
+	user := model.User{
+		Email:     in.Email,
+		FirstName: in.FirstName,
+		LastName:  in.LastName,
+		Roles:     model.TextArray{},
+	}
+	if !in.Active {
+		now := time.Now()
+		user.DisabledAt = &now
+	}
+	if in.Password != "" {
+		if err := checkPassword(in.Password, &user); err != nil {
+			return nil, err
+		}
+		hashed, err := Passwords.Hash(in.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.HashedPassword = hashed
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkEmailFree(tx, in.Email, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return setSCIMExternalID(tx, user.ID, in.ExternalID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:  "register",
+		Actor:   actor,
+		User:    &user,
+		Details: map[string]interface{}{"method": "scim", "active": in.Active},
+	})
+	return &user, nil
+}
+
+// ReplaceSCIMUser overwrites what SCIM manages of user id. Deactivating a
+// user disables them and revokes their tokens right away.
+func (s *AuthService) ReplaceSCIMUser(actor Actor, id uint, in SCIMUser) (*model.User, error) {
+	user, err := s.scimManagedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	in.Email = strings.TrimSpace(in.Email)
+	if in.Email == "" {
+		return nil, errors.New("userName is required")
+	}
+
+	updates := map[string]interface{}{
+		"email":      in.Email,
+		"first_name": in.FirstName,
+		"last_name":  in.LastName,
+	}
+	if in.Password != "" {
+		next := model.User{Email: in.Email, FirstName: in.FirstName, LastName: in.LastName}
+		if err := checkPassword(in.Password, &next); err != nil {
+			return nil, err
+		}
+		hashed, err := Passwords.Hash(in.Password)
+		if err != nil {
+			return nil, err
+		}
+		updates["hashed_password"] = hashed
+	}
+
+	changed := []string{}
+	if user.Email != in.Email {
+		changed = append(changed, "email")
+	}
+	if user.FirstName != in.FirstName || user.LastName != in.LastName {
+		changed = append(changed, "name")
+	}
+	if in.Password != "" {
+		changed = append(changed, "password")
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkEmailFree(tx, in.Email, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if in.Password != "" {
+			// Like a password reset, a new password signs everyone out
+			if err := revokeUserTokens(tx, user.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+		return setSCIMExternalID(tx, user.ID, in.ExternalID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		s.audit(AuditEvent{
+			Action:  "user_updated",
+			Actor:   actor,
+			User:    user,
+			Details: map[string]interface{}{"method": "scim", "changed": changed},
+		})
+	}
+
+	switch {
+	case in.Active && user.DisabledAt != nil:
+		if err := s.EnableUser(actor, user.ID); err != nil {
+			return nil, err
+		}
+	case !in.Active && user.DisabledAt == nil:
+		if err := s.DisableUser(actor, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetUser(user.ID)
+}
+
+// DeleteSCIMUser deletes user id like DeleteUser, unless they hold a
+// privileged role
+func (s *AuthService) DeleteSCIMUser(actor Actor, id uint) error {
+	if _, err := s.scimManagedUser(id); err != nil {
+		return err
+	}
+	return s.DeleteUser(actor, id)
+}
+
+// scimManagedUser loads user id for a change over SCIM. Users holding a
+// privileged role, directly or in an organization, are refused with
+// ErrPrivilegedUser: a provisioning key must not take over an admin.
+func (s *AuthService) scimManagedUser(id uint) (*model.User, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	privileged, err := holdsPrivilegedRole(s.DB, user)
+	if err != nil {
+		return nil, err
+	}
+	if privileged {
+		return nil, ErrPrivilegedUser
+	}
+	return user, nil
+}
+
+// holdsPrivilegedRole reports whether user holds a privileged role, directly
+// or in any organization
+func holdsPrivilegedRole(tx *gorm.DB, user *model.User) (bool, error) {
+	names := user.RoleList()
+	var memberRoles []model.TextArray
+	if err := tx.Model(&model.Membership{}).Where("user_id = ?", user.ID).Pluck("roles", &memberRoles).Error; err != nil {
+		return false, err
+	}
+	for _, r := range memberRoles {
+		names = append(names, r...)
+	}
+	if containsString(names, ImpersonatorRole) {
+		return true, nil
+	}
+	if len(names) == 0 {
+		return false, nil
+	}
+
+	var roles []model.Role
+	if err := tx.Preload("Permissions").Where("name IN ?", uniqueStrings(names)).Find(&roles).Error; err != nil {
+		return false, err
+	}
+	for i := range roles {
+		if isPrivilegedRole(&roles[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListSCIMGroups returns the unprivileged roles matching a SCIM filter, and
+// their total
+func (s *AuthService) ListSCIMGroups(page SCIMPage) ([]model.Role, int64, error) {
+	privileged, err := s.privilegedRoles()
+	if err != nil {
+		return nil, 0, err
+	}
+	q := s.DB.Model(&model.Role{})
+	if len(privileged) > 0 {
+		q = q.Where("name NOT IN ?", privileged)
+	}
+	if page.Filter != "" {
+		cond, args, err := scimFilterSQL(page.Filter, scimGroupAttrs)
+		if err != nil {
+			return nil, 0, err
+		}
+		q = q.Where(cond, args...)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var roles []model.Role
+	if page.Limit > 0 {
+		if err := q.Preload("Permissions").Order("id").Offset(page.Offset).Limit(page.Limit).Find(&roles).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	return roles, total, nil
+}
+
+// GetRole loads a role with its permissions by ID
+func (s *AuthService) GetRole(id uint) (*model.Role, error) {
+	var role model.Role
+	if err := s.DB.Preload("Permissions").First(&role, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownRole
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetSCIMGroup loads role id like GetRole, as long as it isn't privileged
+func (s *AuthService) GetSCIMGroup(id uint) (*model.Role, error) {
+	role, err := s.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	if isPrivilegedRole(role) {
+		return nil, ErrUnknownRole
+	}
+	return role, nil
+}
+
+// privilegedRoles returns the names of the roles SCIM must not see
+func (s *AuthService) privilegedRoles() ([]string, error) {
+	var roles []model.Role
+	if err := s.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for i := range roles {
+		if isPrivilegedRole(&roles[i]) {
+			names = append(names, roles[i].Name)
+		}
+	}
+	return names, nil
+}
+
+// isPrivilegedRole reports whether role grants any privileged permission,
+// or impersonation, which goes by the role's name
+func isPrivilegedRole(role *model.Role) bool {
+	if role.Name == ImpersonatorRole {
+		return true
+	}
+	perms := permissionNames(role.Permissions)
+	for _, p := range privilegedPermissions {
+		if utils.PermissionGranted(perms, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleMembers returns the users holding role
+func (s *AuthService) RoleMembers(role string) ([]model.User, error) {
+	var users []model.User
+	err := s.DB.Where("roles @> ARRAY[?]::text[]", role).Order("id").Find(&users).Error
+	return users, err
+}
+
+// CreateSCIMGroup creates a role without permissions, held by members.
+// Admins decide what it grants.
+func (s *AuthService) CreateSCIMGroup(actor Actor, name string, members []uint) (*model.Role, error) {
+	var count int64
+	if err := s.DB.Model(&model.Role{}).Where("name = ?", strings.TrimSpace(name)).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRoleExists
+	}
+	role, err := s.CreateRole(actor, name, "Provisioned by SCIM", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.AddRoleMembers(actor, role.Name, members); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// RenameRole renames role id, and the role of every user holding it,
+// directly or in an organization
+func (s *AuthService) RenameRole(actor Actor, id uint, name string) (*model.Role, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("role name is required")
+	}
+	role, err := s.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	oldName := role.Name
+	if oldName == name {
+		return role, nil
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleExists
+		}
+		if err := tx.Model(role).Update("name", name).Error; err != nil {
+			return err
+		}
+		var users []model.User
+		if err := tx.Where("roles @> ARRAY[?]::text[]", oldName).Find(&users).Error; err != nil {
+			return err
+		}
+		for _, u := range users {
+			roles := u.RoleList()
+			for i, r := range roles {
+				if r == oldName {
+					roles[i] = name
+				}
+			}
+			if err := tx.Model(&u).Update("roles", cleanRoles(roles)).Error; err != nil {
+				return err
+			}
+		}
+		var members []model.Membership
+		if err := tx.Where("roles @> ARRAY[?]::text[]", oldName).Find(&members).Error; err != nil {
+			return err
+		}
+		for _, m := range members {
+			roles := m.RoleList()
+			for i, r := range roles {
+				if r == oldName {
+					roles[i] = name
+				}
+			}
+			if err := tx.Model(&m).Update("roles", cleanRoles(roles)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.RoleGrant{}).Where("role = ?", oldName).Update("role", name).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "role_renamed",
+		Actor:      actor,
+		TargetType: "role",
+		TargetID:   name,
+		Details:    map[string]interface{}{"old_name": oldName},
+	})
+	return role, nil
+}
+
+// AddRoleMembers grants role to users. Their current access tokens keep
+// their old roles until refreshed.
+func (s *AuthService) AddRoleMembers(actor Actor, role string, userIDs []uint) error {
+	return s.changeRoleMembers(actor, role, userIDs, nil)
+}
+
+// RemoveRoleMembers takes role away from users
+func (s *AuthService) RemoveRoleMembers(actor Actor, role string, userIDs []uint) error {
+	return s.changeRoleMembers(actor, role, nil, userIDs)
+}
+
+// SetRoleMembers makes userIDs the only holders of role
+func (s *AuthService) SetRoleMembers(actor Actor, role string, userIDs []uint) error {
+	members, err := s.RoleMembers(role)
+	if err != nil {
+		return err
+	}
+	keep := map[uint]bool{}
+	for _, id := range userIDs {
+		keep[id] = true
+	}
+	var remove []uint
+	for _, u := range members {
+		if !keep[u.ID] {
+			remove = append(remove, u.ID)
+		}
+	}
+	return s.changeRoleMembers(actor, role, userIDs, remove)
+}
+
+func (s *AuthService) changeRoleMembers(actor Actor, role string, add, remove []uint) error {
+	var added, removed []uint
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if len(add) > 0 {
+			var users []model.User
+			if err := tx.Where("id IN ?", add).Find(&users).Error; err != nil {
+				return err
+			}
+			if len(users) != len(uniqueIDs(add)) {
+				return fmt.Errorf("%w: unknown member", gorm.ErrRecordNotFound)
+			}
+			for _, u := range users {
+				roles := u.RoleList()
+				if containsString(roles, role) {
+					continue
+				}
+				if err := tx.Model(&u).Update("roles", cleanRoles(append(roles, role))).Error; err != nil {
+					return err
+				}
+				added = append(added, u.ID)
+			}
+		}
+		if len(remove) > 0 {
+			var users []model.User
+			if err := tx.Where("id IN ? AND roles @> ARRAY[?]::text[]", remove, role).Find(&users).Error; err != nil {
+				return err
+			}
+			for _, u := range users {
+				var roles []string
+				for _, r := range u.RoleList() {
+					if r != role {
+						roles = append(roles, r)
+					}
+				}
+				if err := tx.Model(&u).Update("roles", cleanRoles(roles)).Error; err != nil {
+					return err
+				}
+				removed = append(removed, u.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(added) > 0 || len(removed) > 0 {
+		s.audit(AuditEvent{
+			Action:     "role_members_updated",
+			Actor:      actor,
+			TargetType: "role",
+			TargetID:   role,
+			Details:    map[string]interface{}{"added": added, "removed": removed},
+		})
+	}
+	return nil
+}
+
+// DeleteSCIMGroup takes role id away from everyone and deletes it
+func (s *AuthService) DeleteSCIMGroup(actor Actor, id uint) error {
+	role, err := s.GetRole(id)
+	if err != nil {
+		return err
+	}
+	members, err := s.RoleMembers(role.Name)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint, len(members))
+	for i, u := range members {
+		ids[i] = u.ID
+	}
+	if err := s.RemoveRoleMembers(actor, role.Name, ids); err != nil {
+		return err
+	}
+	return s.DeleteRole(actor, role.Name)
+}
+
+// checkEmailFree fails with ErrEmailTaken when a user other than id has email
+func checkEmailFree(tx *gorm.DB, email string, id uint) error {
+	var count int64
+	if err := tx.Model(&model.User{}).Where("LOWER(email) = LOWER(?) AND id <> ?", email, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// setSCIMExternalID links user to the SCIM client's externalId, or unlinks
+// them when it is empty
+func setSCIMExternalID(tx *gorm.DB, userID uint, externalID string) error {
+	if err := tx.Where("issuer = ? AND user_id = ?", scimIssuer, userID).Delete(&model.ExternalIdentity{}).Error; err != nil {
+		return err
+	}
+	if externalID == "" {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&model.ExternalIdentity{}).Where("issuer = ? AND subject = ?", scimIssuer, externalID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrExternalIDTaken
+	}
+	return tx.Create(&model.ExternalIdentity{UserID: userID, Issuer: scimIssuer, Subject: externalID}).Error
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	var out []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
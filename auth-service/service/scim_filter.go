@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// scimAttr says how a SCIM attribute is stored
+type scimAttr struct {
+	column string
+	kind   string // "string", "id", "time", "active", "external_id", "member"
+}
+
+// scimUserAttrs and scimGroupAttrs are the attributes filters may use,
+// keyed by their lowercased path
+var (
+	scimUserAttrs = map[string]scimAttr{
+		"id":                {"id", "id"},
+		"username":          {"email", "string"},
+		"emails":            {"email", "string"},
+		"emails.value":      {"email", "string"},
+		"name.givenname":    {"first_name", "string"},
+		"name.familyname":   {"last_name", "string"},
+		"externalid":        {"", "external_id"},
+		"active":            {"disabled_at", "active"},
+		"meta.created":      {"created_at", "time"},
+		"meta.lastmodified": {"updated_at", "time"},
+	}
+	scimGroupAttrs = map[string]scimAttr{
+		"id":                {"id", "id"},
+		"displayname":       {"name", "string"},
+		"members":           {"", "member"},
+		"members.value":     {"", "member"},
+		"meta.created":      {"created_at", "time"},
+		"meta.lastmodified": {"updated_at", "time"},
+	}
+)
+
+// scimFilterSQL turns a SCIM filter (RFC 7644 section 3.4.2.2) into a SQL
+// condition over attrs. String comparisons are case-insensitive, as
+// userName and displayName are caseExact=false.
+func scimFilterSQL(filter string, attrs map[string]scimAttr) (string, []interface{}, error) {
+	p := &scimFilterParser{tokens: tokenizeSCIMFilter(filter), attrs: attrs}
+	if len(p.tokens) == 0 {
+		return "", nil, fmt.Errorf("%w: empty", ErrInvalidFilter)
+	}
+	sql, args, err := p.or()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return "", nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos])
+	}
+	return sql, args, nil
+}
+
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+	attrs  map[string]scimAttr
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *scimFilterParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *scimFilterParser) or() (string, []interface{}, error) {
+	sql, args, err := p.and()
+	for err == nil && strings.EqualFold(p.peek(), "or") {
+		p.next()
+		var right string
+		var rargs []interface{}
+		right, rargs, err = p.and()
+		sql, args = "("+sql+" OR "+right+")", append(args, rargs...)
+	}
+	return sql, args, err
+}
+
+func (p *scimFilterParser) and() (string, []interface{}, error) {
+	sql, args, err := p.unary()
+	for err == nil && strings.EqualFold(p.peek(), "and") {
+		p.next()
+		var right string
+		var rargs []interface{}
+		right, rargs, err = p.unary()
+		sql, args = "("+sql+" AND "+right+")", append(args, rargs...)
+	}
+	return sql, args, err
+}
+
+func (p *scimFilterParser) unary() (string, []interface{}, error) {
+	switch t := p.peek(); {
+	case strings.EqualFold(t, "not"):
+		p.next()
+		if p.next() != "(" {
+			return "", nil, fmt.Errorf("%w: expected ( after not", ErrInvalidFilter)
+		}
+		sql, args, err := p.or()
+		if err != nil {
+			return "", nil, err
+		}
+		if p.next() != ")" {
+			return "", nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+		}
+		return "NOT " + sql, args, nil
+	case t == "(":
+		p.next()
+		sql, args, err := p.or()
+		if err != nil {
+			return "", nil, err
+		}
+		if p.next() != ")" {
+			return "", nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+		}
+		return sql, args, nil
+	}
+	return p.comparison()
+}
+
+func (p *scimFilterParser) comparison() (string, []interface{}, error) {
+	path := p.next()
+	// Drop a schema URN prefix such as urn:ietf:params:scim:schemas:core:2.0:User:userName
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		path = path[i+1:]
+	}
+	attr, ok := p.attrs[strings.ToLower(path)]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unsupported attribute %q", ErrInvalidFilter, path)
+	}
+	op := strings.ToLower(p.next())
+	if op == "pr" {
+		return attr.present()
+	}
+	raw := p.next()
+	if raw == "" {
+		return "", nil, fmt.Errorf("%w: missing value", ErrInvalidFilter)
+	}
+	return attr.compare(op, raw)
+}
+
+func (a scimAttr) present() (string, []interface{}, error) {
+	switch a.kind {
+	case "active", "id":
+		return "TRUE", nil, nil
+	case "external_id":
+		return "id IN (SELECT user_id FROM external_identities WHERE issuer = ?)", []interface{}{scimIssuer}, nil
+	case "member":
+		return "EXISTS (SELECT 1 FROM users WHERE roles.name = ANY(users.roles))", nil, nil
+	}
+	return fmt.Sprintf("COALESCE(%s::text, '') <> ''", a.column), nil, nil
+}
+
+func (a scimAttr) compare(op, raw string) (string, []interface{}, error) {
+	switch a.kind {
+	case "string", "external_id":
+		value, err := scimString(raw)
+		if err != nil {
+			return "", nil, err
+		}
+		column := a.column
+		var cond string
+		var arg interface{}
+		switch op {
+		case "eq":
+			cond, arg = "ILIKE ?", escapeLike(value)
+		case "ne":
+			cond, arg = "NOT ILIKE ?", escapeLike(value)
+		case "co":
+			cond, arg = "ILIKE ?", "%"+escapeLike(value)+"%"
+		case "sw":
+			cond, arg = "ILIKE ?", escapeLike(value)+"%"
+		case "ew":
+			cond, arg = "ILIKE ?", "%"+escapeLike(value)
+		default:
+			return "", nil, fmt.Errorf("%w: %s is not supported here", ErrInvalidFilter, op)
+		}
+		if a.kind == "external_id" {
+			return "id IN (SELECT user_id FROM external_identities WHERE issuer = ? AND subject " + cond + ")",
+				[]interface{}{scimIssuer, arg}, nil
+		}
+		return column + " " + cond, []interface{}{arg}, nil
+
+	case "id", "member":
+		value, err := scimString(raw)
+		if err != nil {
+			return "", nil, err
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || (op != "eq" && op != "ne") {
+			return "", nil, fmt.Errorf("%w: ids only support eq and ne", ErrInvalidFilter)
+		}
+		var sql string
+		if a.kind == "member" {
+			sql = "roles.name IN (SELECT unnest(users.roles) FROM users WHERE users.id = ?)"
+		} else {
+			sql = a.column + " = ?"
+		}
+		if op == "ne" {
+			sql = "NOT " + sql
+		}
+		return sql, []interface{}{id}, nil
+
+	case "active":
+		var active bool
+		switch strings.ToLower(raw) {
+		case "true":
+			active = true
+		case "false":
+		default:
+			return "", nil, fmt.Errorf("%w: active takes true or false", ErrInvalidFilter)
+		}
+		if op == "ne" {
+			active = !active
+		} else if op != "eq" {
+			return "", nil, fmt.Errorf("%w: active only supports eq and ne", ErrInvalidFilter)
+		}
+		if active {
+			return "disabled_at IS NULL", nil, nil
+		}
+		return "disabled_at IS NOT NULL", nil, nil
+
+	case "time":
+		value, err := scimString(raw)
+		if err != nil {
+			return "", nil, err
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %q is not an RFC 3339 time", ErrInvalidFilter, value)
+		}
+		ops := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+		sqlOp, ok := ops[op]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s is not supported here", ErrInvalidFilter, op)
+		}
+		return a.column + " " + sqlOp + " ?", []interface{}{t}, nil
+	}
+	return "", nil, ErrInvalidFilter
+}
+
+// scimString unquotes a JSON string literal; bare numbers are taken as is
+func scimString(raw string) (string, error) {
+	if strings.HasPrefix(raw, `"`) {
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("%w: bad string %s", ErrInvalidFilter, raw)
+		}
+		return s, nil
+	}
+	if _, err := strconv.ParseFloat(raw, 64); err == nil {
+		return raw, nil
+	}
+	return "", fmt.Errorf("%w: expected a quoted value, got %s", ErrInvalidFilter, raw)
+}
+
+// tokenizeSCIMFilter splits a filter into words, parentheses and quoted
+// strings (kept with their quotes)
+func tokenizeSCIMFilter(filter string) []string {
+	var tokens []string
+	rs := []rune(filter)
+	for i := 0; i < len(rs); {
+		switch r := rs[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rs) {
+				j = len(rs) - 1
+			}
+			tokens = append(tokens, string(rs[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && rs[j] != '(' && rs[j] != ')' && rs[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, string(rs[i:j]))
+			i = j
+		}
+	}
+	return tokens
+}
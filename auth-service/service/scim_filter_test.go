@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSCIMFilterSQL(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		filter string
+		sql    string
+		args   []interface{}
+	}{
+		{`userName eq "jane@example.com"`, "email ILIKE ?", []interface{}{"jane@example.com"}},
+		{`USERNAME EQ "Jane@Example.com"`, "email ILIKE ?", []interface{}{"Jane@Example.com"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "x"`, "email ILIKE ?", []interface{}{"x"}},
+		{`emails.value ne "x"`, "email NOT ILIKE ?", []interface{}{"x"}},
+		{`name.givenName co "an"`, "first_name ILIKE ?", []interface{}{"%an%"}},
+		{`name.familyName sw "Do"`, "last_name ILIKE ?", []interface{}{"Do%"}},
+		{`userName ew "@example.com"`, "email ILIKE ?", []interface{}{"%@example.com"}},
+		{`userName eq "100%_a\\b"`, "email ILIKE ?", []interface{}{`100\%\_a\\b`}},
+		{`userName eq "say \"hi\""`, "email ILIKE ?", []interface{}{`say "hi"`}},
+		{`userName pr`, "COALESCE(email::text, '') <> ''", nil},
+		{`externalId eq "abc"`, "id IN (SELECT user_id FROM external_identities WHERE issuer = ? AND subject ILIKE ?)",
+			[]interface{}{scimIssuer, "abc"}},
+		{`active eq true`, "disabled_at IS NULL", nil},
+		{`active eq False`, "disabled_at IS NOT NULL", nil},
+		{`active ne true`, "disabled_at IS NOT NULL", nil},
+		{`id eq "42"`, "id = ?", []interface{}{uint64(42)}},
+		{`id ne 42`, "NOT id = ?", []interface{}{uint64(42)}},
+		{`meta.created gt "2024-01-02T03:04:05Z"`, "created_at > ?", []interface{}{created}},
+		{`meta.lastModified le "2024-01-02T03:04:05Z"`, "updated_at <= ?", []interface{}{created}},
+		{`userName eq "a" and name.givenName eq "b"`, "(email ILIKE ? AND first_name ILIKE ?)", []interface{}{"a", "b"}},
+		{`userName eq "a" or name.givenName eq "b" and name.familyName eq "c"`,
+			"(email ILIKE ? OR (first_name ILIKE ? AND last_name ILIKE ?))", []interface{}{"a", "b", "c"}},
+		{`(userName eq "a" or name.givenName eq "b") and active eq true`,
+			"((email ILIKE ? OR first_name ILIKE ?) AND disabled_at IS NULL)", []interface{}{"a", "b"}},
+		{`not (userName sw "a")`, "NOT email ILIKE ?", []interface{}{"a%"}},
+		{`not(active eq true)or userName eq "x"`, "(NOT disabled_at IS NULL OR email ILIKE ?)", []interface{}{"x"}},
+	}
+	for _, tt := range tests {
+		sql, args, err := scimFilterSQL(tt.filter, scimUserAttrs)
+		if err != nil {
+			t.Errorf("%s: %v", tt.filter, err)
+			continue
+		}
+		if sql != tt.sql || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s:\n got %s %v\nwant %s %v", tt.filter, sql, args, tt.sql, tt.args)
+		}
+	}
+}
+
+func TestSCIMGroupFilterSQL(t *testing.T) {
+	tests := []struct {
+		filter string
+		sql    string
+		args   []interface{}
+	}{
+		{`displayName eq "Ops"`, "name ILIKE ?", []interface{}{"Ops"}},
+		{`members eq "42"`, "roles.name IN (SELECT unnest(users.roles) FROM users WHERE users.id = ?)", []interface{}{uint64(42)}},
+		{`members.value ne "7"`, "NOT roles.name IN (SELECT unnest(users.roles) FROM users WHERE users.id = ?)", []interface{}{uint64(7)}},
+		{`members pr`, "EXISTS (SELECT 1 FROM users WHERE roles.name = ANY(users.roles))", nil},
+	}
+	for _, tt := range tests {
+		sql, args, err := scimFilterSQL(tt.filter, scimGroupAttrs)
+		if err != nil {
+			t.Errorf("%s: %v", tt.filter, err)
+			continue
+		}
+		if sql != tt.sql || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s:\n got %s %v\nwant %s %v", tt.filter, sql, args, tt.sql, tt.args)
+		}
+	}
+
+	// User attributes aren't group attributes
+	if _, _, err := scimFilterSQL(`userName eq "x"`, scimGroupAttrs); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("userName on groups: err = %v", err)
+	}
+}
+
+func TestSCIMFilterSQLInvalid(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`   `,
+		`password eq "x"`,                        // unknown attribute
+		`userName eq`,                            // missing value
+		`userName eq jane`,                       // unquoted string
+		`userName eq "jane`,                      // unterminated string
+		`userName eq "a" and`,                    // dangling operator
+		`userName eq "a" userName eq "b"`,        // missing operator
+		`(userName eq "a"`,                       // missing )
+		`not userName eq "a"`,                    // not without (
+		`userName gt "a"`,                        // ordering on a string
+		`userName xx "a"`,                        // unknown operator
+		`active eq "yes"`,                        // not a boolean
+		`active gt true`,                         // ordering on a boolean
+		`id co "4"`,                              // substring on an id
+		`id eq "four"`,                           // not a number
+		`meta.created gt "yesterday"`,            // not a time
+		`meta.created co "2024-01-02T03:04:05Z"`, // substring on a time
+		`emails[type eq "work"].value eq "x"`,    // value filters aren't supported
+	} {
+		if sql, _, err := scimFilterSQL(filter, scimUserAttrs); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%q: got %q, %v; want ErrInvalidFilter", filter, sql, err)
+		}
+	}
+}
+
+func TestTokenizeSCIMFilter(t *testing.T) {
+	got := tokenizeSCIMFilter(`not(userName eq "a \"b\" (c)")or x pr`)
+	want := []string{"not", "(", "userName", "eq", `"a \"b\" (c)"`, ")", "or", "x", "pr"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid, revoked or expired api key")
+	ErrScopeNotHeld  = errors.New("cannot grant a scope you don't have")
+)
+
+var (
+	// APIKeyTTL is how long an API key stays valid when none is given
+	APIKeyTTL = 90 * 24 * time.Hour
+	// APIKeyUsageInterval is how often a key's last-used time is written
+	APIKeyUsageInterval = time.Minute
+)
+
+// CreateServiceAccount adds a service account; it can't do anything until
+// it is given an API key
+func (s *AuthService) CreateServiceAccount(actor Actor, name, description string) (*model.ServiceAccount, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	account := model.ServiceAccount{Name: name, Description: description, CreatedByID: actor.UserID}
+	if err := s.DB.Create(&account).Error; err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "service_account_created",
+		Actor:      actor,
+		TargetType: "service_account",
+		TargetID:   account.Name,
+	})
+	return &account, nil
+}
+
+// ListServiceAccounts returns every service account
+func (s *AuthService) ListServiceAccounts() ([]model.ServiceAccount, error) {
+	var accounts []model.ServiceAccount
+	err := s.DB.Order("name").Find(&accounts).Error
+	return accounts, err
+}
+
+// DeleteServiceAccount removes a service account together with its keys
+func (s *AuthService) DeleteServiceAccount(actor Actor, id uint) error {
+	var account model.ServiceAccount
+	if err := s.DB.First(&account, id).Error; err != nil {
+		return err
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_account_id = ?", account.ID).Delete(&model.APIKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&account).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "service_account_deleted",
+		Actor:      actor,
+		TargetType: "service_account",
+		TargetID:   account.Name,
+	})
+	return nil
+}
+
+// checkScopesHeld returns ErrScopeNotHeld unless actor holds every scope,
+// so nobody hands out more than they have; "*" needs "*"
+func checkScopesHeld(actor Actor, scopes []string) error {
+	for _, scope := range scopes {
+		if !utils.PermissionGranted(actor.Permissions, scope) {
+			return fmt.Errorf("%w: %s", ErrScopeNotHeld, scope)
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey issues a key for service account accountID granting scopes.
+// The key itself is returned only here; afterwards only its prefix is known.
+func (s *AuthService) CreateAPIKey(actor Actor, accountID uint, name string, scopes []string, ttl time.Duration) (*model.APIKey, string, error) {
+	var account model.ServiceAccount
+	if err := s.DB.First(&account, accountID).Error; err != nil {
+		return nil, "", err
+	}
+	if ttl <= 0 {
+		ttl = APIKeyTTL
+	}
+
+	scopes = uniqueStrings(scopes)
+	if err := checkScopesHeld(actor, scopes); err != nil {
+		return nil, "", err
+	}
+	if _, err := findPermissions(s.DB, scopes); err != nil {
+		return nil, "", err
+	}
+	scopesJSON, err := encodeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefix, err := newAPIKeyPrefix()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := prefix + "." + secret
+
+	apiKey := model.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             name,
+		Prefix:           prefix,
+		KeyHash:          utils.HashToken(key),
+		Scopes:           scopesJSON,
+		ExpiresAt:        time.Now().Add(ttl),
+		CreatedByID:      actor.UserID,
+	}
+	if err := s.DB.Create(&apiKey).Error; err != nil {
+		return nil, "", err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "api_key_created",
+		Actor:      actor,
+		TargetType: "service_account",
+		TargetID:   account.Name,
+		Details: map[string]interface{}{
+			"prefix":     apiKey.Prefix,
+			"scopes":     scopes,
+			"expires_at": apiKey.ExpiresAt,
+		},
+	})
+	return &apiKey, key, nil
+}
+
+// ListAPIKeys returns the keys of service account accountID, newest first
+func (s *AuthService) ListAPIKeys(accountID uint) ([]model.APIKey, error) {
+	if err := s.DB.First(&model.ServiceAccount{}, accountID).Error; err != nil {
+		return nil, err
+	}
+	var keys []model.APIKey
+	err := s.DB.Where("service_account_id = ?", accountID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey stops a key from working immediately
+func (s *AuthService) RevokeAPIKey(actor Actor, accountID, keyID uint) error {
+	var account model.ServiceAccount
+	if err := s.DB.First(&account, accountID).Error; err != nil {
+		return err
+	}
+	var key model.APIKey
+	if err := s.DB.Where("id = ? AND service_account_id = ?", keyID, accountID).First(&key).Error; err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	if err := s.DB.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:     "api_key_revoked",
+		Actor:      actor,
+		TargetType: "service_account",
+		TargetID:   account.Name,
+		Details:    map[string]interface{}{"prefix": key.Prefix},
+	})
+	return nil
+}
+
+// ResolveAPIKey is a utils.APIKeyResolver. The claims it returns carry the
+// key's scopes as permissions and no user.
+func (s *AuthService) ResolveAPIKey(key string) (*utils.Claims, error) {
+	prefix, _, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey model.APIKey
+	if err := s.DB.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(utils.HashToken(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if apiKey.RevokedAt != nil || now.After(apiKey.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var account model.ServiceAccount
+	if err := s.DB.First(&account, apiKey.ServiceAccountID).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > APIKeyUsageInterval {
+		s.DB.Model(&apiKey).Update("last_used_at", now)
+	}
+
+	return &utils.Claims{
+		Permissions:    apiKey.ScopeList(),
+		ServiceAccount: account.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    utils.Issuer,
+			Subject:   "service-account:" + strconv.FormatUint(uint64(account.ID), 10),
+			ExpiresAt: jwt.NewNumericDate(apiKey.ExpiresAt),
+		},
+	}, nil
+}
+
+// newAPIKeyPrefix returns a random, recognizable key prefix
+func newAPIKeyPrefix() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return utils.APIKeyPrefix + strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
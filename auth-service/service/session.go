@@ -0,0 +1,233 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSessionRevoked  = errors.New("session has been revoked")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+var (
+	// SessionDenylistTTL bounds how long another replica may keep accepting
+	// access tokens of a session revoked elsewhere. Revocations made through
+	// this instance apply immediately.
+	SessionDenylistTTL = 30 * time.Second
+	// SessionSeenInterval is how often a session's last-seen time is written
+	// while its access tokens are in use
+	SessionSeenInterval = time.Minute
+)
+
+// saveSession records session id of userID acting in orgID, or refreshes
+// its last-seen time, client and expiry when it already exists. A session
+// never changes organization.
+func saveSession(tx *gorm.DB, id string, userID, orgID uint, client ClientInfo) error {
+	now := time.Now()
+	session := model.Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if orgID != 0 {
+		session.OrgID = &orgID
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen_at", "ip", "user_agent", "expires_at"}),
+	}).Create(&session).Error
+}
+
+// ListSessions returns the active sessions of userID, most recently used first
+func (s *AuthService) ListSessions(userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	err := s.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession signs one session of userID out: its refresh tokens stop
+// working and its access tokens are rejected from now on
+func (s *AuthService) RevokeSession(actor Actor, userID uint, sessionID string) error {
+	user, err := s.AdminUser(actor, userID)
+	if err != nil {
+		return err
+	}
+	var session model.Session
+	if err := s.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	// Acting in an organization, an admin only signs out sessions there
+	if actor.OrgID != 0 && actor.UserID != userID &&
+		(session.OrgID == nil || *session.OrgID != actor.OrgID) {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeFamily(tx, session.ID, time.Now())
+	}); err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:  "session_revoked",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"session": session.ID, "tokens_revoked": true},
+	})
+	return nil
+}
+
+// RevokeAllSessions signs userID out everywhere
+func (s *AuthService) RevokeAllSessions(actor Actor, userID uint) error {
+	user, err := s.accountAdminUser(actor, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeUserTokens(tx, user.ID, time.Now())
+	}); err != nil {
+		return err
+	}
+
+	s.audit(AuditEvent{
+		Action:  "sessions_revoked",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"tokens_revoked": true},
+	})
+	return nil
+}
+
+// CheckTokenSession is a utils.TokenCheck rejecting access tokens of revoked
+// sessions or revoked individually, and noting when each session was last
+// used. Tokens without a jti pass.
+func (s *AuthService) CheckTokenSession(claims *utils.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	revoked, err := sessionStatus.contains(s.DB, claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrSessionRevoked
+	}
+
+	if sessionStatus.dueForSeen(claims.ID) {
+		s.DB.Model(&model.Session{}).Where("id = ?", claims.ID).Update("last_seen_at", time.Now())
+	}
+	return nil
+}
+
+// revokeSessions marks sessions revoked and denies their access tokens
+func revokeSessions(tx *gorm.DB, ids []string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Model(&model.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", at).Error; err != nil {
+		return err
+	}
+	sessionStatus.add(at, ids...)
+	return nil
+}
+
+// sessionCache is the denylist of sessions and tokens revoked recently enough
+// that access tokens issued to them may still be unexpired, and when each
+// session was last seen
+type sessionCache struct {
+	mu       sync.Mutex
+	revoked  map[string]time.Time
+	loadedAt time.Time
+	seen     map[string]time.Time
+}
+
+var sessionStatus = &sessionCache{revoked: map[string]time.Time{}, seen: map[string]time.Time{}}
+
+func (d *sessionCache) contains(db *gorm.DB, id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if time.Since(d.loadedAt) > SessionDenylistTTL {
+		cutoff := time.Now().Add(-maxTokenTTL())
+		var rows []model.Session
+		if err := db.Select("id", "revoked_at").
+			Where("revoked_at > ?", cutoff).
+			Find(&rows).Error; err != nil {
+			return false, err
+		}
+		var tokens []model.RevokedToken
+		if err := db.Where("revoked_at > ?", cutoff).Find(&tokens).Error; err != nil {
+			return false, err
+		}
+		// Merge rather than replace, so a revocation made here whose
+		// transaction hadn't committed yet isn't forgotten
+		for _, r := range rows {
+			d.revoked[r.ID] = *r.RevokedAt
+		}
+		for _, t := range tokens {
+			d.revoked[t.JTI] = t.RevokedAt
+		}
+		for k, at := range d.revoked {
+			if at.Before(cutoff) {
+				delete(d.revoked, k)
+			}
+		}
+		d.loadedAt = time.Now()
+	}
+	_, ok := d.revoked[id]
+	return ok, nil
+}
+
+// maxTokenTTL is the longest any token carrying a session or token ID lives,
+// which is how long its revocation must be remembered
+func maxTokenTTL() time.Duration {
+	return max(utils.AccessTokenTTL, ImpersonationTTL)
+}
+
+func (d *sessionCache) add(at time.Time, ids ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range ids {
+		d.revoked[id] = at
+	}
+}
+
+// dueForSeen reports whether the last-seen time of id should be written,
+// and if so assumes it will be
+func (d *sessionCache) dueForSeen(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.seen[id]) < SessionSeenInterval {
+		return false
+	}
+	d.seen[id] = now
+	// Forget sessions whose access tokens have all expired
+	for k, t := range d.seen {
+		if now.Sub(t) > maxTokenTTL()+SessionSeenInterval {
+			delete(d.seen, k)
+		}
+	}
+	return true
+}
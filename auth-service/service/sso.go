@@ -0,0 +1,174 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/oidc"
+	"auth-service/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSSODisabled     = errors.New("single sign-on is not configured")
+	ErrInvalidSSOState = errors.New("invalid, used or expired sign-on request")
+	ErrSSOFailed       = errors.New("identity provider sign-in failed")
+	ErrAccountLocked   = errors.New("account is locked")
+)
+
+var (
+	// SSOLoginTTL is how long a user has to finish signing in at the provider
+	SSOLoginTTL = 10 * time.Minute
+	// SSOAutoProvision creates users on their first sign-on. When off, only
+	// existing accounts can sign on.
+	SSOAutoProvision = true
+	// SSOGroupsClaim is the ID token claim listing the user's groups
+	SSOGroupsClaim = "groups"
+	// SSOGroupRoles maps provider groups to roles. Roles named here are
+	// managed by the provider: they are granted and taken away on every
+	// sign-on. Other roles are left as admins set them.
+	SSOGroupRoles = map[string][]string{}
+	// SSOSuccessURL is where the browser lands after signing on, with the
+	// tokens in the URL fragment. Empty answers the callback with JSON.
+	SSOSuccessURL = ""
+)
+
+// ParseGroupRoles parses a group to role mapping such as
+// "engineering=Employee,hr-team=HR,hr-team=Employee"
+func ParseGroupRoles(spec string) (map[string][]string, error) {
+	mapping := map[string][]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid group mapping %q, want group=Role", pair)
+		}
+		mapping[group] = append(mapping[group], role)
+	}
+	return mapping, nil
+}
+
+// StartSSOLogin begins an authorization code flow and returns the provider
+// URL to send the browser to, and the state the callback must come back with
+func (s *AuthService) StartSSOLogin() (string, string, error) {
+	if s.OIDC == nil {
+		return "", "", ErrSSODisabled
+	}
+
+	state, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	url, err := s.OIDC.AuthCodeURL(state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.DB.Create(&model.SSOLogin{
+		StateHash:    utils.HashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(SSOLoginTTL),
+	}).Error; err != nil {
+		return "", "", err
+	}
+	return url, state, nil
+}
+
+// CompleteSSOLogin redeems the code the provider sent back with state,
+// provisions or updates the user and signs them in like Login does,
+// including the risk checks and second factor
+func (s *AuthService) CompleteSSOLogin(state, code string, client ClientInfo) (*LoginResult, error) {
+	if s.OIDC == nil {
+		return nil, ErrSSODisabled
+	}
+
+	// Claim the request first so a state can't be used twice
+	var login model.SSOLogin
+	if err := s.DB.Where("state_hash = ?", utils.HashToken(state)).First(&login).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidSSOState
+		}
+		return nil, err
+	}
+	if login.UsedAt != nil || time.Now().After(login.ExpiresAt) {
+		return nil, ErrInvalidSSOState
+	}
+	res := s.DB.Model(&model.SSOLogin{}).
+		Where("id = ? AND used_at IS NULL", login.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidSSOState
+	}
+
+	idToken, err := s.OIDC.Exchange(code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		s.audit(AuditEvent{
+			Action:  "login_failed",
+			Outcome: OutcomeFailure,
+			Actor:   Actor{Client: client},
+			Details: map[string]interface{}{"method": "oidc", "reason": "provider_error", "error": err.Error()},
+		})
+		return nil, fmt.Errorf("%w: %v", ErrSSOFailed, err)
+	}
+
+	user, _, err := provisionExternalUser(s.DB, externalUser{
+		Method:        "oidc",
+		Issuer:        s.OIDC.Issuer,
+		Subject:       idToken.Subject,
+		Email:         idToken.Email,
+		EmailVerified: idToken.EmailVerified,
+		FirstName:     idToken.GivenName,
+		LastName:      idToken.FamilyName,
+		Groups:        idToken.Strings(SSOGroupsClaim),
+	}, SSOGroupRoles, SSOAutoProvision, client)
+	if err != nil {
+		reason := "provisioning_failed"
+		switch {
+		case errors.Is(err, ErrNoAccount):
+			reason = "unknown_user"
+		case errors.Is(err, ErrUnverifiedEmail):
+			reason = "unverified_email"
+		case errors.Is(err, ErrPrivilegedLink):
+			reason = "privileged_link"
+		}
+		s.audit(AuditEvent{
+			Action:    "login_failed",
+			Outcome:   OutcomeFailure,
+			Actor:     Actor{Client: client},
+			UserEmail: idToken.Email,
+			Details:   map[string]interface{}{"method": "oidc", "reason": reason, "subject": idToken.Subject},
+		})
+		return nil, err
+	}
+
+	if user.DisabledAt != nil {
+		s.auditLoginFailure(user.Email, user, client, "disabled")
+		return nil, ErrUserDisabled
+	}
+	if user.LockedAt != nil {
+		s.auditLoginFailure(user.Email, user, client, "locked")
+		return nil, ErrAccountLocked
+	}
+
+	// Same as after a password: risk checks, then MFA if enabled
+	return s.finishLogin(user, "oidc", 0, throttleKeys(user.Email, client)[0], client)
+}
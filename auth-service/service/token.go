@@ -0,0 +1,275 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshTokenTTL is how long a refresh token can be redeemed after it is issued
+var RefreshTokenTTL = 7 * 24 * time.Hour
+
+// TokenPair is what a successful login or refresh hands back to the client
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // access token lifetime in seconds
+}
+
+// issueTokens signs an access token for user and stores a new refresh token
+// in familyID
+func (s *AuthService) issueTokens(tx *gorm.DB, user *model.User, familyID string) (*TokenPair, error) {
+	now := time.Now()
+	claims, err := s.accessClaims(tx, user, familyID, now.Add(utils.AccessTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	access, err := utils.GenerateJWT(*claims)
+	if err != nil {
+		return nil, err
+	}
+	expires := claims.ExpiresAt.Time
+
+	refresh, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&model.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(refresh),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(expires.Sub(now).Seconds()),
+	}, nil
+}
+
+// accessClaims builds the claims of an access token of session familyID,
+// expiring at expires. In a session acting in an organization the token
+// carries the user's roles there. Otherwise roles granted for a limited
+// time are included until they run out, and the token expires no later
+// than the first of them.
+func (s *AuthService) accessClaims(tx *gorm.DB, user *model.User, familyID string, expires time.Time) (*utils.Claims, error) {
+	now := time.Now()
+	var session model.Session
+	if err := tx.Select("id", "org_id").Where("id = ?", familyID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	var orgID uint
+	permanent := user.RoleList()
+	var grants []model.RoleGrant
+	if session.OrgID != nil {
+		orgID = *session.OrgID
+		membership, err := findMembership(tx, orgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		permanent = membership.RoleList()
+	} else {
+		var err error
+		if grants, err = activeGrants(tx, user.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	roles := append([]string(nil), permanent...)
+	var roleExpiry map[string]int64
+	for _, g := range grants {
+		if containsString(permanent, g.Role) {
+			continue
+		}
+		if roleExpiry == nil {
+			roleExpiry = map[string]int64{}
+		}
+		if _, seen := roleExpiry[g.Role]; !seen {
+			roles = append(roles, g.Role)
+		}
+		// Overlapping grants of one role: the longest counts
+		if exp := g.ExpiresAt.Unix(); exp > roleExpiry[g.Role] {
+			roleExpiry[g.Role] = exp
+		}
+	}
+	for _, exp := range roleExpiry {
+		if t := time.Unix(exp, 0); t.Before(expires) {
+			expires = t
+		}
+	}
+
+	perms, err := s.ResolvePermissions(roles)
+	if err != nil {
+		return nil, err
+	}
+	if orgID != 0 {
+		if perms, err = orgPermissions(tx, perms); err != nil {
+			return nil, err
+		}
+	}
+	return &utils.Claims{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Roles:       roles,
+		Permissions: perms,
+		RoleExpiry:  roleExpiry,
+		OrgID:       orgID,
+		// Every access token of a session carries its ID, see model.Session
+		RegisteredClaims: jwt.RegisteredClaims{ID: familyID, ExpiresAt: jwt.NewNumericDate(expires)},
+	}, nil
+}
+
+// startSession records a new session for user acting in orgID, 0 for none,
+// and issues its first token pair
+func (s *AuthService) startSession(user *model.User, orgID uint, client ClientInfo) (*TokenPair, error) {
+	var pair *TokenPair
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pair, err = s.startSessionTx(tx, user, orgID, client)
+		return err
+	})
+	return pair, err
+}
+
+func (s *AuthService) startSessionTx(tx *gorm.DB, user *model.User, orgID uint, client ClientInfo) (*TokenPair, error) {
+	familyID, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := saveSession(tx, familyID, user.ID, orgID, client); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(tx, user, familyID)
+}
+
+// Refresh redeems a refresh token for a new token pair. The presented token is
+// revoked on use; presenting it again revokes every token in its family.
+func (s *AuthService) Refresh(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	var (
+		pair   *TokenPair
+		reused *model.RefreshToken
+	)
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var rt model.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(refreshToken)).
+			First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		now := time.Now()
+		if rt.RevokedAt != nil {
+			// Already redeemed: someone is replaying a stolen token. Kill the
+			// family and commit that, then report the reuse to the caller.
+			reused = &rt
+			return revokeFamily(tx, rt.FamilyID, now)
+		}
+		if now.After(rt.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		var user model.User
+		if err := tx.First(&user, rt.UserID).Error; err != nil || user.DisabledAt != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := tx.Model(&rt).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		// The session keeps the organization it was started in
+		if err := saveSession(tx, rt.FamilyID, user.ID, 0, client); err != nil {
+			return err
+		}
+		var err error
+		pair, err = s.issueTokens(tx, &user, rt.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused != nil {
+		var user model.User
+		s.DB.Select("id", "email").First(&user, reused.UserID)
+		s.audit(AuditEvent{
+			Action:  "refresh_token_reuse",
+			Outcome: OutcomeFailure,
+			Actor:   Actor{Client: client},
+			User:    &user,
+			Details: map[string]interface{}{"session": reused.FamilyID, "tokens_revoked": true},
+		})
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// Logout revokes the family of the given refresh token. Unknown tokens are ignored.
+func (s *AuthService) Logout(refreshToken string, client ClientInfo) error {
+	var rt model.RefreshToken
+	err := s.DB.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&rt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := revokeFamily(s.DB, rt.FamilyID, time.Now()); err != nil {
+		return err
+	}
+
+	var user model.User
+	s.DB.Select("id", "email").First(&user, rt.UserID)
+	s.audit(AuditEvent{
+		Action:  "logout",
+		Actor:   actorFor(&user, client),
+		User:    &user,
+		Details: map[string]interface{}{"session": rt.FamilyID, "tokens_revoked": true},
+	})
+	return nil
+}
+
+// revokeFamily revokes every still-active refresh token in familyID and
+// the session they belong to
+func revokeFamily(tx *gorm.DB, familyID string, at time.Time) error {
+	if err := tx.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error; err != nil {
+		return err
+	}
+	return revokeSessions(tx, []string{familyID}, at)
+}
+
+// revokeUserTokens revokes every still-active refresh token and session of userID
+func revokeUserTokens(tx *gorm.DB, userID uint, at time.Time) error {
+	if err := tx.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error; err != nil {
+		return err
+	}
+
+	var ids []string
+	if err := tx.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	return revokeSessions(tx, ids, at)
+}
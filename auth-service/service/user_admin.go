@@ -0,0 +1,293 @@
+package service
+
+import (
+	"auth-service/model"
+	"auth-service/utils"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserDisabled  = errors.New("user is disabled")
+	ErrSelfAdminEdit = errors.New("admins cannot disable, delete or change the roles of their own account")
+)
+
+// UserStatusCacheTTL bounds how long another replica may keep accepting
+// tokens of a user disabled elsewhere. Changes made through this instance
+// apply immediately.
+var UserStatusCacheTTL = 30 * time.Second
+
+// UserFilter narrows ListUsers
+type UserFilter struct {
+	Query    string // case-insensitive substring of the email
+	Role     string
+	Page     int
+	PageSize int
+}
+
+// Normalize clamps the page and page size to sane values
+func (f *UserFilter) Normalize() {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.PageSize < 1 || f.PageSize > 100 {
+		f.PageSize = 20
+	}
+}
+
+// ListUsers returns one page of users matching filter, and the total count.
+// An actor acting in an organization only sees its members.
+func (s *AuthService) ListUsers(actor Actor, filter UserFilter) ([]model.User, int64, error) {
+	filter.Normalize()
+
+	q := s.DB.Model(&model.User{})
+	if actor.OrgID != 0 {
+		q = q.Where("id IN (?)", s.DB.Model(&model.Membership{}).Select("user_id").Where("org_id = ?", actor.OrgID))
+	}
+	if filter.Query != "" {
+		q = q.Where("email ILIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+	if filter.Role != "" {
+		q = q.Where("roles @> ARRAY[?]::text[]", filter.Role)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []model.User
+	err := q.Order("id").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&users).Error
+	return users, total, err
+}
+
+// SetUserRoles replaces the roles of a user. Tokens already issued keep their
+// old roles until they expire; refresh tokens pick up the new ones.
+func (s *AuthService) SetUserRoles(actor Actor, userID uint, roles []string) (*model.User, error) {
+	if actor.UserID == userID {
+		return nil, ErrSelfAdminEdit
+	}
+	// These roles count in every organization
+	if actor.OrgID != 0 {
+		return nil, ErrOrgScoped
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRoles(roles); err != nil {
+		return nil, err
+	}
+	oldRoles := user.RoleList()
+	if err := s.checkGrantable(actor, addedRoles(oldRoles, roles)); err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(user).Update("roles", cleanRoles(roles)).Error; err != nil {
+		return nil, err
+	}
+
+	s.audit(AuditEvent{
+		Action:  "user_roles_updated",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"old_roles": oldRoles, "new_roles": user.RoleList()},
+	})
+	return user, nil
+}
+
+// DisableUser blocks a user from logging in and invalidates their tokens
+func (s *AuthService) DisableUser(actor Actor, userID uint) error {
+	if actor.UserID == userID {
+		return ErrSelfAdminEdit
+	}
+	user, err := s.accountAdminUser(actor, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, user.ID, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	userStatus.set(user.ID, false)
+
+	s.audit(AuditEvent{
+		Action:  "user_disabled",
+		Actor:   actor,
+		User:    user,
+		Details: map[string]interface{}{"tokens_revoked": true},
+	})
+	return nil
+}
+
+// EnableUser lets a disabled user log in again
+func (s *AuthService) EnableUser(actor Actor, userID uint) error {
+	user, err := s.accountAdminUser(actor, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.DB.Model(user).Update("disabled_at", nil).Error; err != nil {
+		return err
+	}
+	userStatus.set(user.ID, true)
+
+	s.audit(AuditEvent{
+		Action: "user_enabled",
+		Actor:  actor,
+		User:   user,
+	})
+	return nil
+}
+
+// DeleteUser removes a user and everything that lets them sign in
+func (s *AuthService) DeleteUser(actor Actor, userID uint) error {
+	if actor.UserID == userID {
+		return ErrSelfAdminEdit
+	}
+	user, err := s.accountAdminUser(actor, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{
+			&model.RefreshToken{},
+			&model.PasswordResetToken{},
+			&model.RecoveryCode{},
+			&model.MFAChallenge{},
+			&model.Session{},
+			&model.ExternalIdentity{},
+			&model.RoleGrant{},
+			&model.Membership{},
+			&model.LoginRecord{},
+			&model.SecurityEvent{},
+			&model.MagicLink{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		return err
+	}
+	userStatus.set(user.ID, false)
+
+	s.audit(AuditEvent{
+		Action: "user_deleted",
+		Actor:  actor,
+		User:   user,
+	})
+	return nil
+}
+
+// AdminUser loads userID for an admin action by actor. An actor acting in
+// an organization only reaches its members; anyone else is not found.
+func (s *AuthService) AdminUser(actor Actor, userID uint) (*model.User, error) {
+	if actor.OrgID != 0 {
+		if _, err := findMembership(s.DB, actor.OrgID, userID); err != nil {
+			if errors.Is(err, ErrNotMember) {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return nil, err
+		}
+	}
+	return s.GetUser(userID)
+}
+
+// accountAdminUser loads userID for an admin action that reaches the whole
+// account, across every organization it belongs to. Only an actor outside
+// any organization may take such actions; one acting in an organization
+// removes the user from it instead.
+func (s *AuthService) accountAdminUser(actor Actor, userID uint) (*model.User, error) {
+	if actor.OrgID != 0 {
+		return nil, ErrOrgScoped
+	}
+	return s.GetUser(userID)
+}
+
+// CheckTokenUser is a utils.TokenCheck rejecting tokens of users that were
+// disabled or deleted after the token was issued, and impersonation tokens
+// of admins that were
+func (s *AuthService) CheckTokenUser(claims *utils.Claims) error {
+	// Tokens issued to OAuth clients have no user
+	if claims.UserID == 0 && claims.ClientID != "" {
+		return nil
+	}
+	if err := s.checkUserActive(claims.UserID); err != nil {
+		return err
+	}
+	if claims.Act != nil {
+		return s.checkUserActive(claims.Act.UserID)
+	}
+	return nil
+}
+
+func (s *AuthService) checkUserActive(id uint) error {
+	active, ok := userStatus.get(id)
+	if !ok {
+		var user model.User
+		err := s.DB.Select("id", "disabled_at").First(&user, id).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			active = false
+		case err != nil:
+			return err
+		default:
+			active = user.DisabledAt == nil
+		}
+		userStatus.set(id, active)
+	}
+	if !active {
+		return ErrUserDisabled
+	}
+	return nil
+}
+
+// userStatusCache remembers for a short while whether a user may use their tokens
+type userStatusCache struct {
+	mu      sync.Mutex
+	entries map[uint]userStatusEntry
+}
+
+type userStatusEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+var userStatus = &userStatusCache{entries: map[uint]userStatusEntry{}}
+
+func (c *userStatusCache) get(id uint) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || time.Since(e.checkedAt) > UserStatusCacheTTL {
+		return false, false
+	}
+	return e.active, true
+}
+
+func (c *userStatusCache) set(id uint, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[id] = userStatusEntry{active: active, checkedAt: time.Now()}
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search term
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs
+const APIKeyPrefix = "tms_"
+
+// APIKeyResolver maps an API key to the claims of its service account
+type APIKeyResolver func(key string) (*Claims, error)
+
+var apiKeyResolver APIKeyResolver
+
+// SetAPIKeyResolver installs the lookup ValidateAPIKey uses
+func SetAPIKeyResolver(resolver APIKeyResolver) {
+	apiKeyResolver = resolver
+}
+
+// IsAPIKey reports whether credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// ValidateAPIKey returns the claims of the service account owning key
+func ValidateAPIKey(key string) (*Claims, error) {
+	if apiKeyResolver == nil {
+		return nil, errors.New("api keys are not enabled")
+	}
+	return apiKeyResolver(key)
+}
+
+// ValidateCredential accepts either an access token or an API key
+func ValidateCredential(credential string) (*Claims, error) {
+	if IsAPIKey(credential) {
+		return ValidateAPIKey(credential)
+	}
+	return ValidateJWT(credential)
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// CheckpointType is the typ header of audit checkpoints. Together with
+// their own issuer and audience it keeps a checkpoint from ever passing as
+// an access token, although both are signed with the same keys.
+const CheckpointType = "audit-checkpoint+jwt"
+
+// checkpointAudience is the aud claim of checkpoints
+const checkpointAudience = "audit-checkpoint"
+
+// checkpointIssuer is the iss claim of checkpoints, set apart from Issuer
+func checkpointIssuer() string {
+	return Issuer + "/audit"
+}
+
+// checkpointKeyFunc is keyFunc for checkpoints, looking past the rotation
+// window
+func checkpointKeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := keys.archived(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// CheckpointClaims is a signed statement of the head of the audit log hash
+// chain at a point in time
+type CheckpointClaims struct {
+	HeadID   uint   `json:"head_id"`
+	HeadHash string `json:"head_hash"`
+	Entries  int64  `json:"entries"`
+	jwt.RegisteredClaims
+}
+
+// SignCheckpoint signs an audit checkpoint with the active JWT key, so anyone
+// holding the JWKS can check it came from this service
+func SignCheckpoint(claims CheckpointClaims) (string, error) {
+	claims.Issuer = checkpointIssuer()
+	claims.Audience = jwt.ClaimStrings{checkpointAudience}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	}
+	return signClaims(claims, CheckpointType)
+}
+
+// ValidateCheckpoint checks the signature of a checkpoint. Checkpoints don't
+// expire: keys that rotated out still verify them, and so do retired keys
+// kept in KeyConfig.RetiredDir once they are gone from the key directory.
+func ValidateCheckpoint(tokenStr string) (*CheckpointClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &CheckpointClaims{}, checkpointKeyFunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(checkpointIssuer()),
+		jwt.WithAudience(checkpointAudience),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if token.Header["typ"] != CheckpointType {
+		return nil, errors.New("not an audit checkpoint")
+	}
+	claims, ok := token.Claims.(*CheckpointClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid checkpoint")
+	}
+	return claims, nil
+}
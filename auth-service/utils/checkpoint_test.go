@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestKey writes a fresh Ed25519 key to dir/<kid>.pem, the private
+// half unless publicOnly, and dates the file at modTime
+func writeTestKey(t *testing.T, dir, kid string, publicOnly bool, modTime time.Time) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeyPEM(t, dir, kid, priv, pub, publicOnly, modTime)
+	return priv
+}
+
+func writeKeyPEM(t *testing.T, dir, kid string, priv ed25519.PrivateKey, pub ed25519.PublicKey, publicOnly bool, modTime time.Time) {
+	t.Helper()
+	var block *pem.Block
+	if publicOnly {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	path := filepath.Join(dir, kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustLoadKeys(t *testing.T, cfg KeyConfig) {
+	t.Helper()
+	if err := LoadKeys(cfg); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+}
+
+func signTestCheckpoint(t *testing.T) string {
+	t.Helper()
+	token, err := SignCheckpoint(CheckpointClaims{HeadID: 42, HeadHash: "abc123", Entries: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "k1", false, time.Now())
+	mustLoadKeys(t, KeyConfig{Dir: dir})
+
+	claims, err := ValidateCheckpoint(signTestCheckpoint(t))
+	if err != nil {
+		t.Fatalf("ValidateCheckpoint: %v", err)
+	}
+	if claims.HeadID != 42 || claims.HeadHash != "abc123" || claims.Entries != 40 {
+		t.Errorf("claims %+v", claims)
+	}
+	if claims.Issuer != checkpointIssuer() || claims.IssuedAt == nil {
+		t.Errorf("issuer %q, issued at %v", claims.Issuer, claims.IssuedAt)
+	}
+}
+
+func TestCheckpointTampered(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "k1", false, time.Now())
+	mustLoadKeys(t, KeyConfig{Dir: dir})
+	token := signTestCheckpoint(t)
+	parts := strings.Split(token, ".")
+
+	// Point the checkpoint at another head, keeping the signature
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	claims["head_hash"] = "def456"
+	forged, _ := json.Marshal(claims)
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if _, err := ValidateCheckpoint(strings.Join(parts, ".")); err == nil {
+		t.Error("checkpoint with altered head accepted")
+	}
+
+	// ...or with a broken signature
+	sig := []byte(token[strings.LastIndex(token, ".")+1:])
+	if sig[0] == 'A' {
+		sig[0] = 'B'
+	} else {
+		sig[0] = 'A'
+	}
+	if _, err := ValidateCheckpoint(token[:strings.LastIndex(token, ".")+1] + string(sig)); err == nil {
+		t.Error("checkpoint with altered signature accepted")
+	}
+}
+
+func TestCheckpointIsNoAccessToken(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "k1", false, time.Now())
+	mustLoadKeys(t, KeyConfig{Dir: dir})
+
+	if _, err := ValidateJWT(signTestCheckpoint(t)); err == nil {
+		t.Error("checkpoint accepted as an access token")
+	}
+	access, err := GenerateJWT(Claims{UserID: 1, Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateCheckpoint(access); err == nil {
+		t.Error("access token accepted as a checkpoint")
+	}
+}
+
+func TestCheckpointOutlivesRotation(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	writeTestKey(t, dir, "k1", false, old)
+	writeTestKey(t, dir, "k2", false, old.Add(time.Hour))
+
+	mustLoadKeys(t, KeyConfig{Dir: dir, ActiveKID: "k1"})
+	checkpoint := signTestCheckpoint(t)
+	access, err := GenerateJWT(Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 took over long enough ago for k1 to leave the rotation window
+	mustLoadKeys(t, KeyConfig{Dir: dir, ActiveKID: "k2", RotationWindow: time.Hour})
+	if _, err := ValidateJWT(access); err == nil {
+		t.Error("access token of a rotated-out key accepted")
+	}
+	if _, err := ValidateCheckpoint(checkpoint); err != nil {
+		t.Errorf("checkpoint of a rotated-out key rejected: %v", err)
+	}
+}
+
+func TestCheckpointRetiredKey(t *testing.T) {
+	dir, retired := t.TempDir(), t.TempDir()
+	priv := writeTestKey(t, dir, "k1", false, time.Now())
+	mustLoadKeys(t, KeyConfig{Dir: dir})
+	checkpoint := signTestCheckpoint(t)
+	access, err := GenerateJWT(Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k1 leaves the key directory; only its public half is kept
+	if err := os.Remove(filepath.Join(dir, "k1.pem")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestKey(t, dir, "k2", false, time.Now())
+
+	mustLoadKeys(t, KeyConfig{Dir: dir})
+	if _, err := ValidateCheckpoint(checkpoint); err == nil {
+		t.Error("checkpoint of a key no longer loaded accepted")
+	}
+
+	writeKeyPEM(t, retired, "k1", nil, priv.Public().(ed25519.PublicKey), true, time.Now())
+	mustLoadKeys(t, KeyConfig{Dir: dir, RetiredDir: retired})
+	if _, err := ValidateCheckpoint(checkpoint); err != nil {
+		t.Errorf("checkpoint of a retired key rejected: %v", err)
+	}
+	if _, err := ValidateJWT(access); err == nil {
+		t.Error("access token of a retired key accepted")
+	}
+	for _, k := range JWKS()["keys"].([]map[string]interface{}) {
+		if k["kid"] == "k1" {
+			t.Error("retired key published in the JWKS")
+		}
+	}
+}
@@ -2,42 +2,178 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("secret")
+// Issuer is put in the iss claim of every token and required when validating
+var Issuer = "auth-service"
+
+// Audience is put in the aud claim of every access token and required when
+// validating, so no other token signed with the same keys passes as one
+var Audience = "talent-platform"
+
+// AccessTokenType is the typ header of access tokens (RFC 9068)
+const AccessTokenType = "at+jwt"
+
+// AccessTokenTTL is how long an access token is valid. Access tokens are kept
+// short-lived; clients renew them with a refresh token.
+var AccessTokenTTL = 15 * time.Minute
 
 type Claims struct {
-	UserID uint
-	Email  string
-	Roles  []string
+	UserID      uint     `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions,omitempty"`
+	// RoleExpiry holds when each time-bound role in Roles runs out, in Unix
+	// seconds; roles not listed are held for good
+	RoleExpiry map[string]int64 `json:"role_exp,omitempty"`
+	// OrgID is the organization the token acts in; Roles are the user's
+	// roles there. Zero outside any organization.
+	OrgID uint `json:"org_id,omitempty"`
+	// Act names the admin really behind a token issued to impersonate its
+	// subject (RFC 8693 actor claim); nil on ordinary tokens
+	Act *ActorClaim `json:"act,omitempty"`
+	// ServiceAccount names the service account an API key belongs to; such
+	// claims have no user
+	ServiceAccount string `json:"service_account,omitempty"`
+	// ClientID and Scope are set on tokens issued to OAuth clients
+	// (RFC 9068); Scope repeats Permissions space-separated
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(id uint, email string, roles []string) (string, error) {
-	claims := Claims{
-		UserID: id,
-		Email:  email,
-		Roles:  roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-		},
+// ActorClaim identifies who acts on behalf of a token's subject
+type ActorClaim struct {
+	Subject string `json:"sub"`
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+}
+
+// Impersonated reports whether the token was issued to an admin acting as
+// its subject
+func (c *Claims) Impersonated() bool {
+	return c.Act != nil
+}
+
+// ActiveRoles returns the roles the token still grants at now, leaving out
+// time-bound roles that ran out
+func (c *Claims) ActiveRoles(now time.Time) []string {
+	if len(c.RoleExpiry) == 0 {
+		return c.Roles
+	}
+	active := make([]string, 0, len(c.Roles))
+	for _, r := range c.Roles {
+		if exp, ok := c.RoleExpiry[r]; ok && now.Unix() >= exp {
+			continue
+		}
+		active = append(active, r)
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return active
+}
+
+// HasPermission reports whether the token grants perm, either directly, via
+// a "resource:*" wildcard or via "*"
+func (c *Claims) HasPermission(perm string) bool {
+	return PermissionGranted(c.Permissions, perm)
+}
+
+// PermissionGranted reports whether held covers perm, the way
+// Claims.HasPermission does
+func PermissionGranted(held []string, perm string) bool {
+	resource, _, _ := strings.Cut(perm, ":")
+	for _, p := range held {
+		if p == "*" || p == perm || p == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateJWT signs an access token for claims. Issuer, subject, audience,
+// issue time and expiry are filled in when left empty.
+func GenerateJWT(claims Claims) (string, error) {
+	now := time.Now()
+	if claims.Issuer == "" {
+		claims.Issuer = Issuer
+	}
+	if claims.Subject == "" {
+		claims.Subject = strconv.FormatUint(uint64(claims.UserID), 10)
+	}
+	if claims.Audience == nil {
+		claims.Audience = jwt.ClaimStrings{Audience}
+	}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(AccessTokenTTL))
+	}
+	return signClaims(claims, AccessTokenType)
+}
+
+// signClaims signs claims with the active key and stamps its kid and typ in
+// the header
+func signClaims(claims jwt.Claims, typ string) (string, error) {
+	key, err := keys.signing()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	token.Header["typ"] = typ
+	return token.SignedString(key.private)
+}
+
+// keyFunc resolves the verification key from the token's kid header
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := keys.verification(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+var parserOptions = []jwt.ParserOption{
+	jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+	jwt.WithExpirationRequired(),
+}
+
+// TokenCheck is an extra rule a correctly signed token must pass, such as
+// its user not having been disabled since the token was issued
+type TokenCheck func(*Claims) error
+
+var tokenChecks []TokenCheck
+
+// AddTokenCheck registers a check that ValidateJWT runs on every token
+func AddTokenCheck(check TokenCheck) {
+	tokenChecks = append(tokenChecks, check)
 }
 
 func ValidateJWT(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keyFunc,
+		append(parserOptions, jwt.WithIssuer(Issuer), jwt.WithAudience(Audience))...)
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	// Other tokens signed with the same keys grant nothing by themselves
+	if typ, _ := token.Header["typ"].(string); !ok || !token.Valid || typ != AccessTokenType {
+		return nil, errors.New("invalid token")
+	}
+	for _, check := range tokenChecks {
+		if err := check(claims); err != nil {
+			return nil, err
+		}
 	}
-	return nil, errors.New("invalid token")
+	return claims, nil
 }
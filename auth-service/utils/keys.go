@@ -0,0 +1,305 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyConfig says where signing keys come from
+type KeyConfig struct {
+	Dir            string        // directory of <kid>.pem files
+	ActiveKID      string        // kid to sign with; defaults to the newest private key in Dir
+	PrivateKeyPEM  string        // inline PEM private key, takes precedence over Dir
+	PrivateKeyID   string        // kid for PrivateKeyPEM
+	RotationWindow time.Duration // how long non-active keys keep verifying after the active key appeared
+	// RetiredDir holds <kid>.pem files of keys taken out of rotation. They
+	// never verify tokens, only audit checkpoints signed back when they
+	// were active; only their public half is kept.
+	RetiredDir string
+}
+
+// signingKey is one entry of the key set. Keys without a private half are
+// only used to verify.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	added   time.Time
+}
+
+type keySet struct {
+	mu       sync.RWMutex
+	active   *signingKey
+	previous map[string]*signingKey
+	// previous keys verify until validUntil; zero means forever
+	validUntil time.Time
+	// retired keys only verify audit checkpoints
+	retired map[string]*signingKey
+}
+
+var keys = &keySet{previous: map[string]*signingKey{}, retired: map[string]*signingKey{}}
+
+// LoadKeys (re)builds the signing key set. With no keys configured it
+// generates an in-memory RSA key, which is only fit for local development
+// because tokens stop verifying on restart and across replicas.
+func LoadKeys(cfg KeyConfig) error {
+	loaded, err := loadKeyDir(cfg.Dir)
+	if err != nil {
+		return err
+	}
+	retired, err := loadKeyDir(cfg.RetiredDir)
+	if err != nil {
+		return err
+	}
+	for _, k := range retired {
+		k.private = nil
+	}
+
+	var active *signingKey
+	switch {
+	case cfg.PrivateKeyPEM != "":
+		if cfg.PrivateKeyID == "" {
+			return errors.New("a key id is required with an inline private key")
+		}
+		k, err := parseKeyPEM(cfg.PrivateKeyID, []byte(cfg.PrivateKeyPEM))
+		if err != nil {
+			return err
+		}
+		k.added = time.Now()
+		active = k
+	case cfg.ActiveKID != "":
+		active = loaded[cfg.ActiveKID]
+		if active == nil {
+			return fmt.Errorf("active key %q not found in %s", cfg.ActiveKID, cfg.Dir)
+		}
+	default:
+		for _, k := range loaded {
+			if k.private != nil && (active == nil || k.added.After(active.added)) {
+				active = k
+			}
+		}
+	}
+
+	if active == nil {
+		log.Println("No JWT signing key configured, generating an ephemeral RSA key")
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		active = &signingKey{
+			kid:     "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+			method:  jwt.SigningMethodRS256,
+			private: priv,
+			public:  priv.Public(),
+			added:   time.Now(),
+		}
+	}
+	if active.private == nil {
+		return fmt.Errorf("active key %q has no private key", active.kid)
+	}
+	delete(loaded, active.kid)
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.active = active
+	keys.previous = loaded
+	keys.retired = retired
+	keys.validUntil = time.Time{}
+	if cfg.RotationWindow > 0 {
+		keys.validUntil = active.added.Add(cfg.RotationWindow)
+	}
+	return nil
+}
+
+// loadKeyDir reads every <kid>.pem file in dir; an empty dir has no keys
+func loadKeyDir(dir string) (map[string]*signingKey, error) {
+	loaded := map[string]*signingKey{}
+	if dir == "" {
+		return loaded, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(f), ".pem")
+		k, err := parseKeyPEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		k.added = info.ModTime()
+		loaded[kid] = k
+	}
+	return loaded, nil
+}
+
+// signing returns the key to sign new tokens with
+func (ks *keySet) signing() (*signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.active == nil {
+		return nil, errors.New("signing keys not loaded")
+	}
+	return ks.active, nil
+}
+
+// verification returns the key with the given kid if it may still verify tokens
+func (ks *keySet) verification(kid string) (*signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.active != nil && ks.active.kid == kid {
+		return ks.active, nil
+	}
+	if k, ok := ks.previous[kid]; ok && ks.previousValid() {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// archived returns the key with the given kid among every key ever loaded,
+// ignoring the rotation window. Only audit checkpoints, which must stay
+// verifiable long after their key rotated out, are checked against it.
+func (ks *keySet) archived(kid string) (*signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.active != nil && ks.active.kid == kid {
+		return ks.active, nil
+	}
+	if k, ok := ks.previous[kid]; ok {
+		return k, nil
+	}
+	if k, ok := ks.retired[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (ks *keySet) previousValid() bool {
+	return ks.validUntil.IsZero() || time.Now().Before(ks.validUntil)
+}
+
+// JWKS returns the public half of every key that can currently verify a
+// token, as a JSON Web Key Set (RFC 7517)
+func JWKS() map[string]interface{} {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	set := []map[string]interface{}{}
+	if keys.active != nil {
+		set = append(set, jwk(keys.active))
+	}
+	if keys.previousValid() {
+		kids := make([]string, 0, len(keys.previous))
+		for kid := range keys.previous {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+		for _, kid := range kids {
+			set = append(set, jwk(keys.previous[kid]))
+		}
+	}
+	return map[string]interface{}{"keys": set}
+}
+
+func jwk(k *signingKey) map[string]interface{} {
+	b64 := base64.RawURLEncoding.EncodeToString
+	out := map[string]interface{}{
+		"kid": k.kid,
+		"alg": k.method.Alg(),
+		"use": "sig",
+	}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		out["kty"] = "RSA"
+		out["n"] = b64(pub.N.Bytes())
+		out["e"] = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		out["kty"] = "EC"
+		out["crv"] = pub.Curve.Params().Name
+		out["x"] = b64(pub.X.FillBytes(make([]byte, size)))
+		out["y"] = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		out["kty"] = "OKP"
+		out["crv"] = "Ed25519"
+		out["x"] = b64(pub)
+	}
+	return out
+}
+
+// parseKeyPEM reads an RSA, P-256 ECDSA or Ed25519 key, private or public
+func parseKeyPEM(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &signingKey{kid: kid}
+	if signer, ok := key.(crypto.Signer); ok {
+		k.private = signer
+		k.public = signer.Public()
+	} else {
+		k.public = key
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+		k.method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k.public)
+	}
+	return k, nil
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 secret of the RFC 4226 and RFC 6238 test vectors
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTPRFC4226(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := hotp(rfcKey, int64(counter)); got != code {
+			t.Errorf("hotp(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// The RFC 6238 vectors have eight digits; six-digit codes are their last six
+var rfc6238 = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+	for _, v := range rfc6238 {
+		code := v.code[len(v.code)-totpDigits:]
+		step, ok := ValidateTOTP(secret, code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP(%s at %d) rejected", code, v.unix)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(%s at %d) step = %d, want %d", code, v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+	code := hotp(rfcKey, 1234567890/totpPeriod)
+	at := time.Unix(1234567890, 0)
+
+	for _, d := range []time.Duration{-totpPeriod * time.Second, totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(secret, code, at.Add(d)); !ok {
+			t.Errorf("code rejected %s from its period", d)
+		}
+	}
+	for _, d := range []time.Duration{-2 * totpPeriod * time.Second, 2 * totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(secret, code, at.Add(d)); ok {
+			t.Errorf("code accepted %s from its period", d)
+		}
+	}
+}
+
+func TestValidateTOTPRejects(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+	at := time.Unix(59, 0)
+	for name, tc := range map[string]struct{ secret, code string }{
+		"wrong code": {secret, "000000"},
+		"short code": {secret, "28708"},
+		"long code":  {secret, "94287082"},
+		"bad secret": {"not base32!", "287082"},
+	} {
+		if _, ok := ValidateTOTP(tc.secret, tc.code, at); ok {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestValidateTOTPLowercaseSecret(t *testing.T) {
+	secret := strings.ToLower(b32.EncodeToString(rfcKey))
+	if _, ok := ValidateTOTP(secret, "287082", time.Unix(59, 0)); !ok {
+		t.Error("lowercase secret rejected")
+	}
+}